@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"emperror.dev/errors"
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+// audit states of a local file
+const (
+	auditArchived        = "archived"             // the checksum is archived with the needed quality, the local copy can be deleted
+	auditUnderReplicated = "under-replicated"     // the checksum is archived below the needed quality
+	auditFailedFixity    = "failed-fixity"        // the checksum is archived, but the last fixity check of an instance failed
+	auditChecksumDiffers = "checksum-differs"     // the signature is archived with another checksum
+	auditNoChecksum      = "no-archived-checksum" // the signature is archived without checksum, the file cannot be compared
+	auditNotArchived     = "not-archived"
+	auditError           = "error"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit <dir>",
+	Short: "Compare local zip files with the archive",
+	Long: `Walk a directory of OCFL zip files, compute their checksums and look them up in the archive by checksum
+	and by signature. The signature is read from the <name>.json sidecar written by copy --metadata or decoded
+	from the file name, names of copies from before the encoding of signatures are tried as well. Every file
+	is reported as
+	  archived          the checksum is archived with the needed quality and no instance failed its last
+	                    fixity check, the local copy can be deleted
+	  under-replicated  the checksum is archived, but below the needed quality
+	  failed-fixity     the checksum is archived, but the last fixity check of an instance failed
+	  checksum-differs  the signature is archived with another checksum
+	  no-archived-checksum
+	                    the signature is archived without checksum, the file cannot be compared
+	  not-archived      neither checksum nor signature are archived
+	A <name>.zip.sha512 sidecar which does not match the computed checksum is reported as well. With
+	trust-sidecars the checksum is read from the sidecar instead of computed, if it is a valid sha512 checksum.
+	audit exits with a non-zero code if a file could not be checked.
+	For example:
+	ona audit /mnt/nas/objects -c C:\Users\config.yml
+	`,
+	Args: cobra.ExactArgs(1),
+	Run:  audit,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().Bool("trust-sidecars", false, "Read the checksum from the .sha512 sidecar if there is one instead of computing it")
+	auditCmd.Flags().IntP("workers", "w", 2, "Number of files checked in parallel")
+	auditCmd.Flags().Bool("json", false, "print the report as json")
+}
+
+// auditResult is the state of a local file in the archive
+type auditResult struct {
+	File              string `json:"file"`
+	Signature         string `json:"signature,omitempty"`
+	Size              int64  `json:"size"`
+	Checksum          string `json:"checksum,omitempty"`
+	SidecarChecksum   string `json:"sidecar-checksum,omitempty"` // only set if it differs from the checksum
+	Status            string `json:"status"`
+	ObjectId          string `json:"object-id,omitempty"`
+	ArchivedSignature string `json:"archived-signature,omitempty"` // signature of the archived object, if it differs
+	ArchivedChecksum  string `json:"archived-checksum,omitempty"`  // checksum of the archived object, if it differs
+	Resulting         int64  `json:"resulting-quality,omitempty"`
+	Needed            int64  `json:"needed-quality,omitempty"`
+	FailedChecks      int    `json:"failed-checks,omitempty"` // instances whose last fixity check failed
+	Error             string `json:"error,omitempty"`
+}
+
+func audit(cmd *cobra.Command, args []string) {
+	dir := args[0]
+	trustSidecars, _ := cmd.Flags().GetBool("trust-sidecars")
+	workers, _ := cmd.Flags().GetInt("workers")
+	asJson, _ := cmd.Flags().GetBool("json")
+	if workers < 1 {
+		workers = 1
+	}
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	defer startMetrics(configObj.Metrics, logger)()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	defer endTracing()
+
+	var files []string
+	if err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".zip") {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		logger.Error().Msgf("cannot read directory '%s': %v", dir, err)
+		markFailed()
+		return
+	}
+	if len(files) == 0 {
+		logger.Info().Msgf("no zip files in '%s'", dir)
+		return
+	}
+	client, err := service.NewClient(*configObj)
+	if err != nil {
+		logger.Error().Msgf("cannot create client: %v", err)
+		markFailed()
+		return
+	}
+	reporter, err := newReporter(cmd, logger, workers > 1 && len(files) > 1)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	reporter = progress.Multi(reporter, metrics.NewReporter(metrics.OperationAudit))
+
+	ctx := cmd.Context()
+	locations := newStorageLocations(client)
+	results := make([]auditResult, len(files))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = auditFile(ctx, client, locations, files[index], trustSidecars, reporter)
+			}
+		}()
+	}
+	for index := range files {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	if ctx.Err() != nil {
+		logger.Error().Msgf("audit of '%s' cancelled", dir)
+		markFailed()
+		return
+	}
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Status == auditError {
+			logger.Error().Msgf("cannot audit '%s': %s", result.File, result.Error)
+		}
+	}
+	if asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			logger.Error().Msgf("cannot write report: %v", err)
+			markFailed()
+		}
+	} else {
+		printAuditResults(os.Stdout, results)
+	}
+	logger.Info().Msgf("%d files: %d archived, %d under-replicated, %d with failed fixity checks, %d with different checksum, %d without archived checksum, %d not archived, %d errors",
+		len(results), counts[auditArchived], counts[auditUnderReplicated], counts[auditFailedFixity], counts[auditChecksumDiffers],
+		counts[auditNoChecksum], counts[auditNotArchived], counts[auditError])
+	if counts[auditError] > 0 {
+		markFailed()
+	}
+}
+
+// auditFile computes the checksum of path and looks it up in the archive
+func auditFile(ctx context.Context, client *service.Client, locations *storageLocations, path string, trustSidecars bool, reporter progress.Reporter) auditResult {
+	result := auditResult{File: path, Status: auditError}
+	if ctx.Err() != nil {
+		result.Error = "audit was cancelled"
+		return result
+	}
+	sidecarChecksum, _ := service.ReadChecksumFile(path)
+	if trustSidecars && isSHA512(sidecarChecksum) {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Size = fileInfo.Size()
+		result.Checksum = strings.ToLower(sidecarChecksum)
+	} else {
+		var err error
+		if result.Size, result.Checksum, err = checksumExisting(ctx, nil, path, reporter); err != nil {
+			result.Error = fmt.Sprintf("cannot calculate checksum: %v", err)
+			return result
+		}
+		if sidecarChecksum != "" && !strings.EqualFold(sidecarChecksum, result.Checksum) {
+			result.SidecarChecksum = sidecarChecksum
+		}
+	}
+	// without signature, the file can only be found by checksum
+	signatures := localSignatures(path)
+	if len(signatures) > 0 {
+		result.Signature = signatures[0]
+	}
+
+	objects, err := client.GetObjectsByChecksum(ctx, result.Checksum)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		result.Error = describeError(err)
+		return result
+	}
+	if objects != nil && len(objects.Objects) > 0 {
+		objectPb := objects.Objects[0]
+		for _, candidate := range objects.Objects {
+			if slices.Contains(signatures, candidate.Signature) {
+				objectPb = candidate
+			}
+		}
+		result.ObjectId = objectPb.Id
+		if slices.Contains(signatures, objectPb.Signature) {
+			result.Signature = objectPb.Signature
+		} else {
+			result.ArchivedSignature = objectPb.Signature
+		}
+		return auditArchive(ctx, client, locations, objectPb, result)
+	}
+
+	var objectPb *pb.Object
+	for _, signature := range signatures {
+		objectPb, err = client.GetObjectBySignature(ctx, signature)
+		if err != nil && !errors.Is(err, service.ErrNotFound) {
+			result.Error = describeError(err)
+			return result
+		}
+		if err == nil && objectPb.Id != "" {
+			result.Signature = signature
+			break
+		}
+		objectPb = nil
+	}
+	if objectPb == nil {
+		result.Status = auditNotArchived
+		return result
+	}
+	result.ObjectId = objectPb.Id
+	if objectPb.Checksum == "" {
+		result.Status = auditNoChecksum
+		return result
+	}
+	metrics.ChecksumFailures.WithLabelValues(metrics.OperationAudit).Inc()
+	result.ArchivedChecksum = objectPb.Checksum
+	result.Status = auditChecksumDiffers
+	return result
+}
+
+// auditArchive sets the status of an archived checksum by the quality and the last fixity checks of the
+// instances of the object
+func auditArchive(ctx context.Context, client *service.Client, locations *storageLocations, objectPb *pb.Object, result auditResult) auditResult {
+	object, err := storedObjectOf(ctx, client, objectPb, locations)
+	if err != nil {
+		result.Error = describeError(err)
+		return result
+	}
+	result.Resulting = object.Resulting
+	result.Needed = object.Needed
+	for _, instance := range object.Instances {
+		if instance.LastCheck != nil && instance.LastCheck.Error {
+			result.FailedChecks++
+		}
+	}
+	switch {
+	case result.FailedChecks > 0:
+		result.Status = auditFailedFixity
+	case len(object.Instances) > 0 && result.Resulting >= result.Needed && result.Resulting > 0:
+		result.Status = auditArchived
+	default:
+		result.Status = auditUnderReplicated
+	}
+	return result
+}
+
+// isSHA512 reports whether checksum is a hex encoded sha512 checksum
+func isSHA512(checksum string) bool {
+	if len(checksum) != sha512.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
+
+// localSignatures returns the signature from the json sidecar of copy --metadata or ingest, or the signatures
+// the file name can stand for
+func localSignatures(path string) []string {
+	data, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".json")
+	if err == nil {
+		sidecar := objectSidecar{}
+		if err := json.Unmarshal(data, &sidecar); err == nil && sidecar.Object != nil && sidecar.Object.Signature != "" {
+			return []string{sidecar.Object.Signature}
+		}
+		object := models.Object{}
+		if err := json.Unmarshal(data, &object); err == nil && object.Signature != "" {
+			return []string{object.Signature}
+		}
+	}
+	return fileNameSignatures(path)
+}
+
+// printAuditResults writes the results as table
+func printAuditResults(w io.Writer, results []auditResult) {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STATUS\tFILE\tSIGNATURE\tQUALITY\tNOTE")
+	for _, result := range results {
+		quality := ""
+		if result.Status == auditArchived || result.Status == auditUnderReplicated || result.Status == auditFailedFixity {
+			quality = fmt.Sprintf("%d/%d", result.Resulting, result.Needed)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", result.Status, result.File, result.Signature, quality, auditNote(result))
+	}
+	writer.Flush()
+}
+
+// auditNote explains a result
+func auditNote(result auditResult) string {
+	var notes []string
+	if result.SidecarChecksum != "" {
+		notes = append(notes, "the checksum sidecar does not match the file")
+	}
+	if result.FailedChecks > 0 {
+		notes = append(notes, fmt.Sprintf("%d instances failed the last fixity check", result.FailedChecks))
+	}
+	if result.ArchivedSignature != "" {
+		notes = append(notes, "archived as "+result.ArchivedSignature)
+	}
+	if result.ArchivedChecksum != "" {
+		notes = append(notes, "archived checksum "+result.ArchivedChecksum)
+	}
+	if result.Status == auditNoChecksum {
+		notes = append(notes, "the archive has no checksum of the object")
+	}
+	if result.Error != "" {
+		notes = append(notes, strings.ReplaceAll(result.Error, "\n", " "))
+	}
+	return strings.Join(notes, "; ")
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/service"
+)
+
+func TestAuditFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(manager *testManager)
+		fileName      string
+		content       string
+		sidecar       string // content of the checksum sidecar
+		jsonSidecar   *objectSidecar
+		trustSidecars bool
+		cancelled     bool
+		want          auditResult
+	}{
+		{
+			name:     "archived",
+			fileName: "alma+1.zip",
+			content:  "a",
+			want:     auditResult{Signature: "alma:1", Status: auditArchived, ObjectId: "1", Resulting: 8, Needed: 6},
+		},
+		{
+			name:     "under-replicated",
+			modify:   func(manager *testManager) { manager.resulting["1"] = 4 },
+			fileName: "alma+1.zip",
+			content:  "a",
+			want:     auditResult{Signature: "alma:1", Status: auditUnderReplicated, ObjectId: "1", Resulting: 4, Needed: 6},
+		},
+		{
+			name: "failed fixity",
+			modify: func(manager *testManager) {
+				manager.lastChecks["i2"] = models.ObjectInstanceCheck{Id: "c1", Checktime: "2026-01-01", Error: true, Message: "checksum mismatch"}
+			},
+			fileName: "alma+1.zip",
+			content:  "a",
+			want:     auditResult{Signature: "alma:1", Status: auditFailedFixity, ObjectId: "1", Resulting: 8, Needed: 6, FailedChecks: 1},
+		},
+		{
+			name: "without optional routes",
+			modify: func(manager *testManager) {
+				manager.locations = nil
+				manager.lastChecks = nil
+			},
+			fileName: "alma+1.zip",
+			content:  "a",
+			want:     auditResult{Signature: "alma:1", Status: auditArchived, ObjectId: "1", Resulting: 8, Needed: 6},
+		},
+		{
+			name:     "archived under another signature",
+			fileName: "alma+9.zip",
+			content:  "a",
+			want:     auditResult{Signature: "alma:9", Status: auditArchived, ObjectId: "1", ArchivedSignature: "alma:1", Resulting: 8, Needed: 6},
+		},
+		{
+			name:        "signature from json sidecar",
+			fileName:    "renamed.zip",
+			content:     "a",
+			jsonSidecar: &objectSidecar{Object: &pb.Object{Signature: "alma:1"}},
+			want:        auditResult{Signature: "alma:1", Status: auditArchived, ObjectId: "1", Resulting: 8, Needed: 6},
+		},
+		{
+			name:     "checksum differs",
+			fileName: "alma+1.zip",
+			content:  "b",
+			want:     auditResult{Signature: "alma:1", Status: auditChecksumDiffers, ObjectId: "1", ArchivedChecksum: sha512Hex("a")},
+		},
+		{
+			name: "no archived checksum",
+			modify: func(manager *testManager) {
+				manager.objects["alma:1"].Checksum = ""
+			},
+			fileName: "alma+1.zip",
+			content:  "b",
+			want:     auditResult{Signature: "alma:1", Status: auditNoChecksum, ObjectId: "1"},
+		},
+		{
+			name:     "not archived",
+			fileName: "alma+2.zip",
+			content:  "b",
+			want:     auditResult{Signature: "alma:2", Status: auditNotArchived},
+		},
+		{
+			name:     "sidecar differs",
+			fileName: "alma+1.zip",
+			content:  "a",
+			sidecar:  sha512Hex("b") + "  alma+1.zip\n",
+			want: auditResult{Signature: "alma:1", Status: auditArchived, ObjectId: "1", Resulting: 8, Needed: 6,
+				SidecarChecksum: sha512Hex("b")},
+		},
+		{
+			name:          "trusted sidecar",
+			fileName:      "alma+1.zip",
+			content:       "changed",
+			sidecar:       sha512Hex("a") + "  alma+1.zip\n",
+			trustSidecars: true,
+			want:          auditResult{Signature: "alma:1", Status: auditArchived, ObjectId: "1", Resulting: 8, Needed: 6},
+		},
+		{
+			name:      "cancelled",
+			fileName:  "alma+1.zip",
+			content:   "a",
+			cancelled: true,
+			want:      auditResult{Status: auditError, Error: "audit was cancelled"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := newStoredTestManager()
+			if test.modify != nil {
+				test.modify(manager)
+			}
+			client := newTestClient(t, manager)
+			folder := t.TempDir()
+			filePath := filepath.Join(folder, test.fileName)
+			if err := os.WriteFile(filePath, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if test.sidecar != "" {
+				if err := os.WriteFile(service.ChecksumFileName(filePath), []byte(test.sidecar), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.jsonSidecar != nil {
+				data, err := json.Marshal(test.jsonSidecar)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(strings.TrimSuffix(filePath, ".zip")+".json", data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelled {
+				cancel()
+			}
+			result := auditFile(ctx, client, newStorageLocations(client), filePath, test.trustSidecars, progress.Nop())
+			want := test.want
+			want.File = filePath
+			if !test.cancelled {
+				want.Size = int64(len(test.content))
+				want.Checksum = sha512Hex(test.content)
+				if test.trustSidecars {
+					want.Checksum = sha512Hex("a")
+				}
+			}
+			if result != want {
+				t.Errorf("expected %+v, got %+v", want, result)
+			}
+		})
+	}
+}
+
+func TestPrintAuditResults(t *testing.T) {
+	results := []auditResult{
+		{File: "a.zip", Signature: "alma:1", Status: auditArchived, Resulting: 8, Needed: 6},
+		{File: "b.zip", Signature: "alma:2", Status: auditFailedFixity, Resulting: 8, Needed: 6, FailedChecks: 1, SidecarChecksum: "x"},
+		{File: "c.zip", Signature: "alma:3", Status: auditChecksumDiffers, ArchivedChecksum: "abc"},
+		{File: "d.zip", Signature: "alma:4", Status: auditNoChecksum},
+		{File: "e.zip", Status: auditError, Error: "cannot calculate checksum:\nbroken"},
+	}
+	buf := &bytes.Buffer{}
+	printAuditResults(buf, results)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(results)+1 {
+		t.Fatalf("expected %d lines, got %q", len(results)+1, lines)
+	}
+	want := []string{
+		"8/6",
+		"the checksum sidecar does not match the file; 1 instances failed the last fixity check",
+		"archived checksum abc",
+		"the archive has no checksum of the object",
+		"cannot calculate checksum: broken",
+	}
+	for index, line := range lines[1:] {
+		if !strings.HasPrefix(line, results[index].Status) || !strings.Contains(line, want[index]) {
+			t.Errorf("expected %s with %q, got %q", results[index].Status, want[index], line)
+		}
+	}
+	if strings.Contains(lines[3], "/") || strings.Contains(lines[4], "/") {
+		t.Errorf("quality should only be shown for archived checksums: %q", lines[3:5])
+	}
+}
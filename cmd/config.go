@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jwalton/go-supportscolor"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Create, validate and show the configuration",
+	Long: `Create, validate and show the configuration.
+	The configuration is merged from the configuration file, ONA_* environmental variables and "set" flags.
+	`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration values, secrets are redacted",
+	Long: `Print the configuration values, secrets are redacted.
+	With "resolved" every key is printed with its effective value and the source of the value.
+	For example:
+	ona config show --resolved -c C:\Users\config.yml --set chunk-size=100
+	`,
+	Run: showConfig,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration and the connections to the archive",
+	Long: `Check required fields and URLs of the configuration, reach the manager, the TUS endpoint and
+	every storage location and verify the credentials. Every problem is reported, the exit code is 1 if
+	there is at least one.
+	For example:
+	ona config validate -c C:\Users\config.yml
+	`,
+	Run: validateConfig,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configShowCmd.Flags().Bool("resolved", false, "print all keys with effective value, source and environmental variable")
+	configValidateCmd.Flags().Bool("offline", false, "only check the configuration values, do not connect")
+}
+
+func showConfig(cmd *cobra.Command, args []string) {
+	resolved, _ := cmd.Flags().GetBool("resolved")
+	configObj, sources, err := loadConfigSources(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if configObj.Profile != "" {
+		fmt.Printf("profile: %s\n", configObj.Profile)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if resolved {
+		fmt.Fprintln(writer, "KEY\tVALUE\tSOURCE\tENVIRONMENT")
+	}
+	for _, value := range service.ResolvedConfig(configObj, sources) {
+		if resolved {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", value.Key, value.Value, value.Source, service.EnvName(value.Key))
+		} else if value.Value != "" {
+			fmt.Fprintf(writer, "%s\t%s\n", value.Key, value.Value)
+		}
+	}
+	writer.Flush()
+}
+
+func validateConfig(cmd *cobra.Command, args []string) {
+	offline, _ := cmd.Flags().GetBool("offline")
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	var checks []service.ConfigCheck
+	if offline {
+		checks = service.CheckConfig(configObj)
+	} else {
+		logger, closeLogger, err := newLogger(cmd, configObj)
+		if err != nil {
+			fmt.Println(err)
+			markFailed()
+			return
+		}
+		checks = service.ValidateConfig(cmd.Context(), configObj, logger)
+		closeLogger()
+	}
+	color := supportscolor.Stdout().SupportsColor
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.Err == nil && color:
+			fmt.Printf("%sOK%s     %s\n", colorGreen, colorNone, check.Name)
+		case check.Err == nil:
+			fmt.Printf("OK     %s\n", check.Name)
+		case color:
+			failed++
+			fmt.Printf("%sFAILED%s %s: %s\n", colorRed, colorNone, check.Name, describeError(check.Err))
+		default:
+			failed++
+			fmt.Printf("FAILED %s: %s\n", check.Name, describeError(check.Err))
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+		markFailed()
+		return
+	}
+	fmt.Println("Configuration is valid")
+}
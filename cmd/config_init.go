@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cobra"
+)
+
+const defaultConfigFile = "ona.yml"
+
+var configInitCmd = &cobra.Command{
+	Use:   "init [file]",
+	Short: "Interactively create a configuration file",
+	Long: `Ask for the connection values and write a commented configuration file, ona.yml if no file is given.
+	The file is readable only for the current user, because it contains secrets.
+	For example:
+	ona config init C:\Users\config.yml
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  initConfig,
+}
+
+func init() {
+	configCmd.AddCommand(configInitCmd)
+	configInitCmd.Flags().BoolP("force", "f", false, "overwrite an existing file")
+}
+
+// configTemplateValues are the answers written into the configuration template
+type configTemplateValues struct {
+	Url          string
+	StatusUrl    string
+	ChunkSize    int64
+	OIDC         bool
+	JwtKey       string
+	Key          string
+	Issuer       string
+	ClientId     string
+	StorageType  string
+	StorageName  string
+	StorageUrl   string
+	StorageKey   string
+	StorageUser  string
+	StorageDir   string
+	Secret       string
+	UploadFolder string
+	LogLevel     string
+}
+
+var configTemplate = template.Must(template.New("config").Parse(`# configuration of ona, created with "ona config init"
+# every value can be overridden with ONA_* environmental variables or "--set key=value",
+# see "ona config show --resolved"
+# secrets (key, jwt-key, storage secret, ...) can be references instead of plain values:
+#   file:/run/secrets/jwt, env:NAME, keyring:service/user or keepass:/path/db.kdbx#entry
+
+# TUS endpoint for uploads
+url: {{ printf "%q" .Url }}
+# base URL of the DLZA manager, without trailing /
+status-url: {{ printf "%q" .StatusUrl }}
+# size of the upload chunks in bytes
+chunk-size: {{ .ChunkSize }}
+# seconds to wait between progress bar refreshes
+bar-pause: 1
+# seconds per request to the manager
+timeout: 60
+# retries of failed requests, -1 disables them
+retries: 3
+{{ if .OIDC }}
+# authentication with "ona login"
+oidc:
+  issuer: {{ printf "%q" .Issuer }}
+  client-id: {{ printf "%q" .ClientId }}
+  # device or client-credentials
+  flow: device
+{{ else }}
+# key to sign the tokens for the manager
+jwt-key: {{ printf "%q" .JwtKey }}
+# key for the TUS server
+key: {{ printf "%q" .Key }}
+{{ end }}
+# storage location objects are copied from
+storage:
+  # S3 or sftp
+  type: {{ printf "%q" .StorageType }}
+  name: {{ printf "%q" .StorageName }}
+  # S3 endpoint or host:port of the sftp server
+  url: {{ printf "%q" .StorageUrl }}
+{{- if eq .StorageType "sftp" }}
+  user: {{ printf "%q" .StorageUser }}
+  base-dir: {{ printf "%q" .StorageDir }}
+  # password, a private-key list can be used instead
+  secret: {{ printf "%q" .Secret }}
+  # known-hosts: []
+{{- else }}
+  # access key id
+  key: {{ printf "%q" .StorageKey }}
+  # secret access key
+  secret: {{ printf "%q" .Secret }}
+{{- end }}
+  upload-folder: {{ printf "%q" .UploadFolder }}
+
+# additional storages for "copy --to vfs://<name>/<folder>"
+# targets: []
+
+# REST API of "ona serve"
+# serve:
+#   addr: localhost:8765
+#   workers: 2
+#   retries: 3
+#   token: env:ONA_SERVE_TOKEN
+#   hosts: []
+#   retention: 30
+
+# Prometheus metrics, served on addr and/or written to textfile when a command ends
+# metrics:
+#   addr: localhost:9464
+#   textfile: /var/lib/node_exporter/textfile/ona.prom
+
+# OpenTelemetry traces, exporter otlp (OTLP/HTTP), stdout (written to stderr) or file
+# tracing:
+#   exporter: otlp
+#   endpoint: http://localhost:4318
+#   file: ona-traces.json
+
+log:
+  # DEBUG, INFO, WARN, ERROR
+  level: {{ .LogLevel }}
+  # file: ona.log
+`))
+
+func initConfig(cmd *cobra.Command, args []string) {
+	force, _ := cmd.Flags().GetBool("force")
+	cfgFilePath := defaultConfigFile
+	if len(args) > 0 {
+		cfgFilePath = filepath.Clean(args[0])
+	}
+	if _, err := os.Stat(cfgFilePath); err == nil && !force {
+		fmt.Printf("%s already exists, use --force to overwrite it\n", cfgFilePath)
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	values := configTemplateValues{}
+	values.Url = ask(reader, "TUS endpoint for uploads", "https://")
+	values.StatusUrl = strings.TrimSuffix(ask(reader, "URL of the DLZA manager", "https://"), "/")
+	chunkSize, err := strconv.ParseInt(ask(reader, "Chunk size in bytes", "10485760"), 10, 64)
+	if err != nil || chunkSize <= 0 {
+		fmt.Println("chunk size must be a positive number")
+		return
+	}
+	values.ChunkSize = chunkSize
+	values.OIDC = ask(reader, "Authentication (jwt or oidc)", "jwt") == "oidc"
+	if values.OIDC {
+		values.Issuer = ask(reader, "OIDC issuer", "https://")
+		values.ClientId = ask(reader, "OIDC client id", "ona")
+	} else {
+		values.JwtKey = ask(reader, "JWT key", "")
+		values.Key = ask(reader, "TUS key", "")
+	}
+	values.StorageType = ask(reader, "Storage type (S3 or sftp)", "S3")
+	values.StorageName = ask(reader, "Storage name", "")
+	if values.StorageType == "sftp" {
+		values.StorageUrl = ask(reader, "sftp server (host:port)", "")
+		values.StorageUser = ask(reader, "sftp user", "")
+		values.StorageDir = ask(reader, "sftp base directory", "/")
+		values.Secret = ask(reader, "sftp password", "")
+	} else {
+		values.StorageUrl = ask(reader, "S3 endpoint", "")
+		values.StorageKey = ask(reader, "S3 access key id", "")
+		values.Secret = ask(reader, "S3 secret access key", "")
+	}
+	values.UploadFolder = ask(reader, "Upload folder", "")
+	values.LogLevel = strings.ToUpper(ask(reader, "Log level", "INFO"))
+
+	if err := writeConfigFile(cfgFilePath, values); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Configuration was written to %s, check it with: ona config validate -c %s\n", cfgFilePath, cfgFilePath)
+}
+
+// writeConfigFile writes the configuration to a temporary file which replaces cfgFilePath when it is complete.
+// The file contains secrets, so it is only readable by the owner, also if an existing file is replaced.
+func writeConfigFile(cfgFilePath string, values configTemplateValues) error {
+	file, err := os.CreateTemp(filepath.Dir(cfgFilePath), "."+filepath.Base(cfgFilePath)+"-")
+	if err != nil {
+		return errors.Wrap(err, "cannot create configuration file")
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "cannot change mode of '%s'", file.Name())
+	}
+	if err := configTemplate.Execute(file, values); err != nil {
+		file.Close()
+		return errors.Wrap(err, "cannot write configuration")
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "cannot write '%s'", file.Name())
+	}
+	if err := os.Rename(file.Name(), cfgFilePath); err != nil {
+		return errors.Wrapf(err, "cannot write '%s'", cfgFilePath)
+	}
+	return nil
+}
+
+// ask prints question and returns the answer, or defaultValue if the answer is empty
+func ask(reader *bufio.Reader, question string, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue
+	}
+	return answer
+}
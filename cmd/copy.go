@@ -1,28 +1,65 @@
 package cmd
 
 import (
-	"crypto/tls"
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/je4/filesystem/v3/pkg/vfsrw"
-	"github.com/je4/utils/v2/pkg/zLogger"
-	"github.com/ocfl-archive/ona/service"
-	"github.com/spf13/cobra"
-	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
-	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/filesystem/v3/pkg/vfsrw"
+	"github.com/je4/filesystem/v3/pkg/writefs"
+	checksumImp "github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	copyStatusCopied  = "copied"
+	copyStatusSkipped = "skipped"
+	copyStatusError   = "error"
+	manifestName      = "manifest.json"
+	stdoutTarget      = "-"
+	vfsPrefix         = "vfs://"
 )
 
 var copyCmd = &cobra.Command{
 	Use:   "copy",
 	Short: "Copy files from storage",
-	Long: `Copy files from storage. A signature should be provided.
+	Long: `Copy files from storage. A signature or a file with signatures should be provided. The DLZA manager cannot
+	list the objects of a collection or search them by metadata, so --collection and --query report an error.
 	For example:
 	ona copy -s alma1234 -p C:\Users -c C:\Users\config.yml
-	will copy alma1234 toC:\Users folder.`,
+	will copy alma1234 toC:\Users folder.
+	ona copy -s alma1234 -p C:\Users -c C:\Users\config.yml --extract --version v2
+	will additionally extract version v2 of alma1234 to C:\Users\alma1234 folder.
+	ona copy -l C:\Users\signatures.txt -p C:\Users -w 8 -c C:\Users\config.yml
+	will copy all signatures listed in signatures.txt (one per line) with 8 parallel downloads
+	and write a manifest.json with checksums, sizes and errors to C:\Users folder.
+	Objects which are already present and verified in the folder are skipped.
+	ona copy -s alma1234 --to - -c C:\Users\config.yml > alma1234.zip
+	will stream alma1234 to stdout.
+	ona copy -s alma1234 --to vfs://researcher/exchange -m C:\Users\manifest.json -c C:\Users\config.yml
+	will copy alma1234 directly to the target storage "researcher" defined in the config file.
+	The checksum is verified while copying.
+	copy exits with a non-zero code if an object could not be copied.
+	ona copy -s alma1234 -p C:\Users --metadata -c C:\Users\config.yml
+	will additionally write the archive metadata with all instances, their storage locations and last fixity
+	checks to alma1234.json and the checksum to alma1234.zip.sha512, so the object can be ingested again.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: copyFile,
@@ -32,104 +69,597 @@ func init() {
 	rootCmd.AddCommand(copyCmd)
 	copyCmd.Flags().StringP("path", "p", "", "Path to folder to copy in")
 	copyCmd.Flags().StringP("signature", "s", "", "signature of file")
+	copyCmd.Flags().StringP("version", "v", "", "OCFL version to extract, head version if empty")
+	copyCmd.Flags().BoolP("extract", "e", false, "Extract the logical state of the object version into a folder")
+	copyCmd.Flags().StringP("list", "l", "", "Path to file with signatures, one per line")
+	copyCmd.Flags().String("collection", "", "Alias of collection to copy, not supported by the DLZA manager")
+	copyCmd.Flags().String("query", "", "Metadata query selecting the objects to copy, not supported by the DLZA manager")
+	copyCmd.Flags().IntP("workers", "w", 4, "Number of parallel downloads")
+	copyCmd.Flags().StringP("manifest", "m", "", "Path to manifest file, <path>/"+manifestName+" if empty, required with --to "+vfsPrefix)
+	copyCmd.Flags().StringP("to", "t", "", "Target instead of path: - for stdout or vfs://<target>/<folder> for a target storage")
+	copyCmd.Flags().Bool("metadata", false, "Write archive metadata and checksum sidecar files next to the object")
+}
+
+// copyResult is one entry of the manifest written by copy
+type copyResult struct {
+	Signature string `json:"signature"`
+	File      string `json:"file,omitempty"`
+	Size      int64  `json:"size"`
+	Checksum  string `json:"checksum,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// objectSidecar is the archive metadata written next to a copied object. Instances are the instances of all
+// storage locations with the last fixity check where known, Storage is the location the object was copied from.
+type objectSidecar struct {
+	Object    *pb.Object       `json:"object"`
+	Instances []storedInstance `json:"instances"`
+	Resulting int64            `json:"resulting-quality"`
+	Needed    int64            `json:"needed-quality"`
+	Storage   string           `json:"storage"`
+	Retrieved string           `json:"retrieved"`
+}
+
+type copyOptions struct {
+	path     string
+	to       string
+	version  string
+	extract  bool
+	metadata bool
+	reporter progress.Reporter
 }
 
 func copyFile(cmd *cobra.Command, args []string) {
-	cfgFilePath, err := cmd.Flags().GetString("config")
+	signature, err := cmd.Flags().GetString("signature")
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	signature, err := cmd.Flags().GetString("signature")
+	path, err := cmd.Flags().GetString("path")
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	path, err := cmd.Flags().GetString("path")
+	version, err := cmd.Flags().GetString("version")
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	configObj := service.GetConfig(cfgFilePath)
-
-	hostname, err := os.Hostname()
+	extract, err := cmd.Flags().GetBool("extract")
 	if err != nil {
-		log.Fatalf("cannot get hostname: %v", err)
+		fmt.Println(err)
+		return
 	}
-
-	var loggerTLSConfig *tls.Config
-	var loggerLoader io.Closer
-	if configObj.Log.Stash.TLS != nil {
-		loggerTLSConfig, loggerLoader, err = loader.CreateClientLoader(configObj.Log.Stash.TLS, nil)
-		if err != nil {
-			log.Fatalf("cannot create client loader: %v", err)
-		}
-		defer loggerLoader.Close()
+	if version != "" && !extract {
+		fmt.Println("You should use --extract together with --version")
+		markFailed()
+		return
 	}
-	_logger, _logstash, _logfile, err := ublogger.CreateUbMultiLoggerTLS(configObj.Log.Level, configObj.Log.File,
-		ublogger.SetDataset(configObj.Log.Stash.Dataset),
-		ublogger.SetLogStash(configObj.Log.Stash.LogstashHost, configObj.Log.Stash.LogstashPort, configObj.Log.Stash.Namespace, configObj.Log.Stash.LogstashTraceLevel),
-		ublogger.SetTLS(configObj.Log.Stash.TLS != nil),
-		ublogger.SetTLSConfig(loggerTLSConfig),
-	)
-
+	listPath, err := cmd.Flags().GetString("list")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	collection, err := cmd.Flags().GetString("collection")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	query, err := cmd.Flags().GetString("query")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	workers, err := cmd.Flags().GetInt("workers")
 	if err != nil {
-		log.Fatalf("cannot create logger: %v", err)
+		fmt.Println(err)
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	manifestPath, err := cmd.Flags().GetString("manifest")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	to, err := cmd.Flags().GetString("to")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if to != "" && path != "" {
+		fmt.Println("You should specify either --path or --to")
+		markFailed()
+		return
+	}
+	if to != "" && extract {
+		fmt.Println("You cannot use --extract together with --to")
+		markFailed()
+		return
+	}
+	metadata, err := cmd.Flags().GetBool("metadata")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if to == stdoutTarget && metadata {
+		fmt.Println("You cannot use --metadata together with --to -")
+		markFailed()
+		return
+	}
+	if to != "" && to != stdoutTarget && !strings.HasPrefix(to, vfsPrefix) {
+		fmt.Println("--to should be - or start with " + vfsPrefix)
+		markFailed()
+		return
+	}
+	if strings.HasPrefix(to, vfsPrefix) && manifestPath == "" {
+		fmt.Println("You should specify --manifest together with --to " + vfsPrefix)
+		markFailed()
+		return
+	}
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
 	}
 
-	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
-	var logger zLogger.ZLogger = &l2
-	if _logstash != nil {
-		defer _logstash.Close()
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
 	}
-	if _logfile != nil {
-		defer _logfile.Close()
+	defer closeLogger()
+	defer startMetrics(configObj.Metrics, logger)()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
 	}
+	defer endTracing()
 
-	objectInstance, err := service.GetObjectInstancesBySignatureAndLocationsPathName(signature, *configObj)
+	client, err := service.NewClient(*configObj)
 	if err != nil {
-		logger.Panic().Msgf("error extracting object instance with signature: %s", signature, err)
+		logger.Error().Msgf("cannot create client: %v", err)
+		markFailed()
 		return
 	}
+	ctx := cmd.Context()
 
-	vfsConfig, err := service.LoadVfsConfig(*configObj)
+	var selected []string
+	if signature != "" {
+		selected = append(selected, signature)
+	}
+	signatures, err := collectSignatures(selected, listPath, collection, query)
 	if err != nil {
-		logger.Panic().Msgf("error mapping json for storage location connection field: %v", err)
+		logger.Error().Msgf("cannot collect signatures: %v", err)
+		markFailed()
+		return
+	}
+	if len(signatures) == 0 {
+		logger.Error().Msgf("You should specify a signature or a list of signatures")
+		markFailed()
+		return
+	}
+	if to == stdoutTarget && len(signatures) > 1 {
+		logger.Error().Msgf("Only one object can be streamed to stdout")
+		markFailed()
+		return
+	}
+	if len(signatures) > 1 && !confirm(cmd, configObj, fmt.Sprintf("copy %d objects", len(signatures))) {
+		logger.Info().Msgf("copy cancelled")
 		return
 	}
 
-	vfs, err := vfsrw.NewFS(vfsConfig, &l2)
+	reporter, err := newReporter(cmd, logger, workers > 1 && len(signatures) > 1)
 	if err != nil {
-		logger.Panic().Err(err).Msg("cannot create vfs")
+		logger.Error().Msgf("%v", err)
+		markFailed()
 		return
 	}
-	defer func() {
+	options := copyOptions{path: path, to: to, version: version, extract: extract, metadata: metadata, reporter: reporter}
+	var results []copyResult
+	vfs, closeFS, err := newCopyFS(*configObj, logger)
+	if err != nil {
+		// no object can be copied, the manifest lists them as failed
+		logger.Error().Msgf("%v", err)
+		results = failedResults(signatures, err)
+	} else {
+		defer closeFS()
+		results = copyObjects(ctx, client, vfs, signatures, workers, options, logger)
+	}
+
+	if to != stdoutTarget && (len(signatures) > 1 || manifestPath != "") {
+		if manifestPath == "" {
+			manifestPath = filepath.Join(path, manifestName)
+		}
+		if err := writeManifest(manifestPath, results); err != nil {
+			logger.Error().Msgf("cannot write manifest '%s': %v", manifestPath, err)
+			markFailed()
+			return
+		}
+		logger.Info().Msgf("Manifest was written to %s", manifestPath)
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Status == copyStatusError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		logger.Error().Msgf("%d of %d objects could not be copied", failed, len(results))
+		markFailed()
+	}
+}
+
+// newCopyFS creates the vfs of the storage and the targets of the configuration, closeFS closes it
+func newCopyFS(configObj configuration.Config, logger zLogger.ZLogger) (_ fs.FS, closeFS func(), _ error) {
+	vfsConfig, err := service.LoadVfsConfig(configObj)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error mapping json for storage location connection field")
+	}
+	vfs, err := vfsrw.NewFS(vfsConfig, logger)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create vfs")
+	}
+	return vfs, func() {
 		if err := vfs.Close(); err != nil {
 			logger.Error().Err(err).Msg("cannot close vfs")
 		}
+	}, nil
+}
+
+// failedResults returns an error result with err for every signature
+func failedResults(signatures []string, err error) []copyResult {
+	results := make([]copyResult, len(signatures))
+	for index, signature := range signatures {
+		results[index] = copyResult{Signature: signature, Status: copyStatusError, Error: err.Error()}
+	}
+	return results
+}
+
+// copyObjects copies the objects with the given number of parallel workers, the results are in the order of
+// signatures
+func copyObjects(ctx context.Context, client *service.Client, vfs fs.FS, signatures []string, workers int, options copyOptions, logger zLogger.ZLogger) []copyResult {
+	results := make([]copyResult, len(signatures))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = copyObject(ctx, client, vfs, signatures[index], options, logger)
+			}
+		}()
+	}
+	for index := range signatures {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// collectSignatures gathers the given signatures and the signatures of the list. The manager cannot select
+// objects by collection or query, so these fail with service.ErrNotSupported.
+func collectSignatures(selected []string, listPath string, collection string, query string) ([]string, error) {
+	if collection != "" {
+		return nil, errors.Wrapf(service.ErrNotSupported, "listing the objects of collection '%s'", collection)
+	}
+	if query != "" {
+		return nil, errors.Wrapf(service.ErrNotSupported, "searching objects with query '%s'", query)
+	}
+	signatures := append([]string{}, selected...)
+	if listPath != "" {
+		listFile, err := os.Open(filepath.Clean(listPath))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot open signature list '%s'", listPath)
+		}
+		defer listFile.Close()
+		scanner := bufio.NewScanner(listFile)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			signatures = append(signatures, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "cannot read signature list '%s'", listPath)
+		}
+	}
+	unique := make([]string, 0, len(signatures))
+	seen := map[string]bool{}
+	for _, sig := range signatures {
+		if !seen[sig] {
+			seen[sig] = true
+			unique = append(unique, sig)
+		}
+	}
+	return unique, nil
+}
+
+// copyObject copies the object with the given signature from the vfs to the local folder and verifies its checksum.
+// Objects already present with the checksum known to the archive are skipped.
+func copyObject(ctx context.Context, client *service.Client, vfs fs.FS, signature string, options copyOptions, logger zLogger.ZLogger) (result copyResult) {
+	result = copyResult{Signature: signature, Status: copyStatusError}
+	ctx, span := tracing.Start(ctx, "copy", attribute.String("ona.signature", signature))
+	defer func() {
+		span.SetAttributes(attribute.String("ona.status", result.Status))
+		if result.Status == copyStatusError {
+			logger.Error().Msgf("cannot copy %s: %s", signature, result.Error)
+			tracing.End(span, errors.New(result.Error))
+			return
+		}
+		span.End()
 	}()
-	sourceFP, err := vfs.Open(objectInstance.Path)
+
+	if ctx.Err() != nil {
+		result.Error = "copy was cancelled"
+		return
+	}
+	reporter := progress.Multi(options.reporter, metrics.NewReporter(metrics.OperationCopy))
+	objectPb, err := client.GetObjectBySignature(ctx, signature)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		result.Error = fmt.Sprintf("error extracting object with signature %s: %s", signature, describeError(err))
+		return
+	}
+	if objectPb.Id == "" {
+		result.Error = fmt.Sprintf("object with signature %s does not exist", signature)
+		return
+	}
+	objectInstance, err := client.GetObjectInstancesBySignatureAndLocationsPathName(ctx, signature)
 	if err != nil {
-		logger.Panic().Msgf("cannot read file '%s': %v", signature, err)
+		result.Error = fmt.Sprintf("error extracting object instance with signature %s: %s", signature, describeError(err))
 		return
 	}
+
+	fileName := service.SignatureFileName(signature, ".zip")
+	var fullPath string
+	switch {
+	case options.to == stdoutTarget:
+		fullPath = stdoutTarget
+	case options.to != "":
+		fullPath = strings.TrimSuffix(options.to, "/") + "/" + fileName
+	default:
+		fullPath = filepath.ToSlash(filepath.Clean(fmt.Sprintf("%s/%s", options.path, fileName)))
+	}
+	result.File = fullPath
+
+	skipped := false
+	if fullPath != stdoutTarget && objectPb.Checksum != "" {
+		size, checksum, err := checksumExisting(ctx, vfs, fullPath, reporter)
+		if err == nil && strings.EqualFold(checksum, objectPb.Checksum) {
+			logger.Info().Msgf("File %s is already present and verified. %s", signature, fullPath)
+			result.Size = size
+			result.Checksum = checksum
+			skipped = true
+		}
+	}
+	if !skipped {
+		logger.Info().Msgf("Copying %s...", signature)
+		result.Size, result.Checksum, err = downloadObject(ctx, vfs, objectInstance.Path, fullPath, objectPb.Size, reporter, logger)
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+		if objectPb.Checksum != "" && !strings.EqualFold(result.Checksum, objectPb.Checksum) {
+			metrics.ChecksumFailures.WithLabelValues(metrics.OperationCopy).Inc()
+			result.Error = fmt.Sprintf("checksum mismatch: expected %s, got %s", objectPb.Checksum, result.Checksum)
+			if fullPath != stdoutTarget {
+				if err := removeDestination(vfs, fullPath); err != nil {
+					logger.Error().Msgf("cannot remove '%s': %v", fullPath, err)
+				}
+			}
+			return
+		}
+		logger.Info().Msgf("File %s with size %d bytes was copied. %s", signature, result.Size, fullPath)
+	}
+
+	if options.metadata {
+		stored, err := storedObjectOf(ctx, client, objectPb, newStorageLocations(client))
+		if err != nil {
+			result.Error = fmt.Sprintf("cannot get instances of %s: %s", signature, describeError(err))
+			return
+		}
+		if err := writeSidecars(vfs, fullPath, objectPb, stored, result.Checksum, client.Config().Storage.Name); err != nil {
+			result.Error = fmt.Sprintf("cannot write sidecar files for '%s': %v", fullPath, err)
+			return
+		}
+	}
+
+	if options.extract {
+		extractPath := strings.TrimSuffix(fullPath, ".zip")
+		logger.Info().Msgf("Extracting %s...", signature)
+		task := reporter.Start(progress.PhasePackaging, extractPath, 0)
+		result.Version, err = service.CheckoutVersion(ctx, fullPath, options.version, extractPath, logger)
+		task.Finish(err)
+		if err != nil {
+			result.Error = fmt.Sprintf("cannot extract file '%s': %v", fullPath, err)
+			return
+		}
+		logger.Info().Msgf("Version %s of %s was extracted to %s", result.Version, signature, extractPath)
+	}
+	if skipped {
+		result.Status = copyStatusSkipped
+	} else {
+		result.Status = copyStatusCopied
+	}
+	return
+}
+
+// writeSidecars writes the archive metadata as <name>.json and the checksum as <name>.zip.sha512 in the format
+// accepted by ingest
+func writeSidecars(vfs fs.FS, fullPath string, objectPb *pb.Object, stored storedObject, checksum string, storageName string) error {
+	sidecar := objectSidecar{
+		Object:    objectPb,
+		Instances: stored.Instances,
+		Resulting: stored.Resulting,
+		Needed:    stored.Needed,
+		Storage:   storageName,
+		Retrieved: time.Now().Format(time.RFC3339),
+	}
+	metadataPath := strings.TrimSuffix(fullPath, ".zip") + ".json"
+	metadataFP, err := createDestination(vfs, metadataPath)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create '%s'", metadataPath)
+	}
+	encoder := json.NewEncoder(metadataFP)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sidecar); err != nil {
+		metadataFP.Close()
+		return errors.Wrapf(err, "cannot write '%s'", metadataPath)
+	}
+	if err := metadataFP.Close(); err != nil {
+		return errors.Wrapf(err, "cannot close '%s'", metadataPath)
+	}
+
+	checksumPath := service.ChecksumFileName(fullPath)
+	checksumFP, err := createDestination(vfs, checksumPath)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create '%s'", checksumPath)
+	}
+	if _, err := fmt.Fprintf(checksumFP, "%s%s%s\n", checksum, service.ChecksumSeparator, filepath.Base(fullPath)); err != nil {
+		checksumFP.Close()
+		return errors.Wrapf(err, "cannot write '%s'", checksumPath)
+	}
+	if err := checksumFP.Close(); err != nil {
+		return errors.Wrapf(err, "cannot close '%s'", checksumPath)
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// createDestination opens fullPath for writing. fullPath is either stdout, a vfs path or a local path.
+func createDestination(vfs fs.FS, fullPath string) (io.WriteCloser, error) {
+	switch {
+	case fullPath == stdoutTarget:
+		return nopWriteCloser{Writer: os.Stdout}, nil
+	case strings.HasPrefix(fullPath, vfsPrefix):
+		return writefs.Create(vfs, fullPath)
+	default:
+		return os.Create(fullPath)
+	}
+}
+
+func removeDestination(vfs fs.FS, fullPath string) error {
+	if strings.HasPrefix(fullPath, vfsPrefix) {
+		return writefs.Remove(vfs, fullPath)
+	}
+	return os.Remove(fullPath)
+}
+
+// checksumExisting returns size and checksum of an already existing destination file
+func checksumExisting(ctx context.Context, vfs fs.FS, fullPath string, reporter progress.Reporter) (_ int64, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "checksum", attribute.String("ona.path", fullPath))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	var fp fs.File
+	if strings.HasPrefix(fullPath, vfsPrefix) {
+		fp, err = vfs.Open(fullPath)
+	} else {
+		fp, err = os.Open(fullPath)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	defer fp.Close()
+	fileInfo, err := fp.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	task := reporter.Start(progress.PhaseChecksum, fullPath, fileInfo.Size())
+	checksum, err := service.Checksum(progress.NewReader(service.NewContextReader(ctx, fp), task))
+	task.Finish(err)
+	if err != nil {
+		return 0, "", err
+	}
+	return fileInfo.Size(), checksum, nil
+}
+
+// downloadObject copies sourcePath from the vfs to fullPath and returns the size and the checksum of the copied data.
+// If the copy fails or ctx is cancelled, the partial destination file is removed. size is the expected size for
+// the progress report.
+func downloadObject(ctx context.Context, vfs fs.FS, sourcePath string, fullPath string, size int64, reporter progress.Reporter, logger zLogger.ZLogger) (written int64, checksum string, err error) {
+	ctx, span := tracing.Start(ctx, "download", attribute.String("ona.source", sourcePath), attribute.String("ona.path", fullPath), attribute.Int64("ona.size", size))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	sourceFP, err := vfs.Open(sourcePath)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "cannot read file '%s'", sourcePath)
+	}
 	defer func() {
 		if err := sourceFP.Close(); err != nil {
 			logger.Error().Msgf("cannot close source: %v", err)
 		}
 	}()
-	signature = strings.Replace(signature, ":", "_", -1)
-	fullPath := filepath.ToSlash(filepath.Clean(fmt.Sprintf("%s/%s.zip", path, signature)))
-	destination, err := os.Create(fullPath)
+	destination, err := createDestination(vfs, fullPath)
 	if err != nil {
-		logger.Panic().Msgf("cannot create destination for file '%s%s': %v", signature, path, err)
-		return
+		return 0, "", errors.Wrapf(err, "cannot create destination '%s'", fullPath)
 	}
-	logger.Info().Msgf("Copying...")
-	written, err := io.Copy(destination, sourceFP)
+	defer func() {
+		if err == nil || fullPath == stdoutTarget {
+			return
+		}
+		if removeErr := removeDestination(vfs, fullPath); removeErr != nil {
+			logger.Error().Msgf("cannot remove partial file '%s': %v", fullPath, removeErr)
+		}
+	}()
+	task := reporter.Start(progress.PhaseDownload, fullPath, size)
+	defer func() {
+		task.Finish(err)
+	}()
+	csWriter, err := checksumImp.NewChecksumWriter(
+		[]checksumImp.DigestAlgorithm{service.ChecksumType},
+		destination,
+	)
 	if err != nil {
-		logger.Panic().Msgf("cannot copy file '%s%s': %v", signature, path, err)
-		return
+		destination.Close()
+		return 0, "", errors.Wrap(err, "cannot create checksum writer")
+	}
+	written, err = io.Copy(csWriter, progress.NewReader(service.NewContextReader(ctx, sourceFP), task))
+	if err != nil {
+		csWriter.Close()
+		destination.Close()
+		return 0, "", errors.Wrapf(err, "cannot copy file '%s'", fullPath)
+	}
+	if err := csWriter.Close(); err != nil {
+		destination.Close()
+		return 0, "", errors.Wrap(err, "cannot close checksum writer")
+	}
+	if err := destination.Close(); err != nil {
+		return 0, "", errors.Wrapf(err, "cannot close destination '%s'", fullPath)
+	}
+	checksums, err := csWriter.GetChecksums()
+	if err != nil {
+		return 0, "", errors.Wrap(err, "cannot get checksum")
+	}
+	return written, checksums[service.ChecksumType], nil
+}
+
+func writeManifest(manifestPath string, results []copyResult) error {
+	manifestFile, err := os.Create(filepath.Clean(manifestPath))
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		manifestFile.Close()
+		return err
 	}
-	logger.Info().Msgf("File %s with size %d bytes was copied. %s", signature, written, fullPath)
+	return manifestFile.Close()
 }
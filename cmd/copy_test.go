@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"emperror.dev/errors"
+	"github.com/je4/filesystem/v3/pkg/writefs"
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/rs/zerolog"
+)
+
+func sha512Hex(data string) string {
+	digest := sha512.Sum512([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestCollectSignatures(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "signatures.txt")
+	if err := os.WriteFile(listPath, []byte("sig-b\n\n# comment\n  sig-c  \nsig-a\nsig-b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		selected   []string
+		listPath   string
+		collection string
+		query      string
+		want       []string
+		wantErr    error
+	}{
+		{name: "signature", selected: []string{"sig-a"}, want: []string{"sig-a"}},
+		{name: "list", listPath: listPath, want: []string{"sig-b", "sig-c", "sig-a"}},
+		{name: "signature and list", selected: []string{"sig-a"}, listPath: listPath, want: []string{"sig-a", "sig-b", "sig-c"}},
+		{name: "nothing", want: []string{}},
+		{name: "collection", collection: "test-collection", wantErr: service.ErrNotSupported},
+		{name: "query", query: "title:test", wantErr: service.ErrNotSupported},
+		{name: "missing list", listPath: filepath.Join(t.TempDir(), "missing.txt"), wantErr: os.ErrNotExist},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signatures, err := collectSignatures(test.selected, test.listPath, test.collection, test.query)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(signatures, test.want) {
+				t.Errorf("expected %v, got %v", test.want, signatures)
+			}
+		})
+	}
+}
+
+func TestCopyObjects(t *testing.T) {
+	manager := &testManager{
+		objects: map[string]*pb.Object{
+			"sig-a": {Id: "1", Signature: "sig-a", Size: 1, Checksum: sha512Hex("a")},
+			"sig-b": {Id: "2", Signature: "sig-b", Size: 1, Checksum: sha512Hex("b")},
+			"sig-c": {Id: "3", Signature: "sig-c", Size: 1, Checksum: sha512Hex("other")},
+			"sig-e": {Id: "5", Signature: "sig-e", Size: 1, Checksum: sha512Hex("e")},
+		},
+		instances: map[string]*pb.ObjectInstance{
+			"sig-a": {Id: "i1", ObjectId: "1", Path: "storage/sig-a.zip"},
+			"sig-b": {Id: "i2", ObjectId: "2", Path: "storage/sig-b.zip"},
+			"sig-c": {Id: "i3", ObjectId: "3", Path: "storage/sig-c.zip"},
+		},
+	}
+	client := newTestClient(t, manager)
+	storage := fstest.MapFS{
+		"storage/sig-a.zip": {Data: []byte("a")},
+		"storage/sig-b.zip": {Data: []byte("b")},
+		"storage/sig-c.zip": {Data: []byte("c")},
+	}
+	folder := t.TempDir()
+	// sig-b was copied by a previous run
+	if err := os.WriteFile(filepath.Join(folder, "sig-b.zip"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.Nop()
+	options := copyOptions{path: folder, reporter: progress.Nop()}
+	signatures := []string{"sig-a", "sig-b", "sig-c", "sig-d", "sig-e"}
+	results := copyObjects(context.Background(), client, storage, signatures, 3, options, &logger)
+
+	tests := []struct {
+		signature string
+		status    string
+		content   string // content of the destination, empty if it must not exist
+	}{
+		{signature: "sig-a", status: copyStatusCopied, content: "a"},
+		{signature: "sig-b", status: copyStatusSkipped, content: "b"},
+		{signature: "sig-c", status: copyStatusError},
+		{signature: "sig-d", status: copyStatusError},
+		{signature: "sig-e", status: copyStatusError},
+	}
+	if len(results) != len(tests) {
+		t.Fatalf("expected %d results, got %d", len(tests), len(results))
+	}
+	for index, test := range tests {
+		t.Run(test.signature, func(t *testing.T) {
+			result := results[index]
+			if result.Signature != test.signature || result.Status != test.status {
+				t.Fatalf("expected %s %s, got %s %s (%s)", test.signature, test.status, result.Signature, result.Status, result.Error)
+			}
+			if (result.Error != "") != (test.status == copyStatusError) {
+				t.Errorf("unexpected error '%s'", result.Error)
+			}
+			data, err := os.ReadFile(filepath.Join(folder, test.signature+".zip"))
+			if test.content == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("destination of %s should not exist: %v", test.signature, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.content {
+				t.Errorf("expected content '%s', got '%s'", test.content, data)
+			}
+			if result.Checksum != sha512Hex(test.content) {
+				t.Errorf("expected checksum of '%s', got %s", test.content, result.Checksum)
+			}
+		})
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), manifestName)
+	results := append([]copyResult{{Signature: "sig-a", File: "sig-a.zip", Size: 1, Checksum: sha512Hex("a"), Status: copyStatusCopied}},
+		failedResults([]string{"sig-b", "sig-c"}, errors.New("cannot create vfs"))...)
+	if err := writeManifest(manifestPath, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest []copyResult
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest, results) {
+		t.Errorf("expected %v, got %v", results, manifest)
+	}
+	for _, result := range manifest[1:] {
+		if result.Status != copyStatusError || result.Error != "cannot create vfs" {
+			t.Errorf("expected failed result, got %v", result)
+		}
+	}
+}
+
+// testWriteFS is a vfs with write support, paths are given with vfs:// as copy does
+type testWriteFS struct {
+	sync.Mutex
+	files fstest.MapFS
+}
+
+func (f *testWriteFS) Open(name string) (fs.File, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.files.Open(strings.TrimPrefix(name, vfsPrefix))
+}
+
+func (f *testWriteFS) Create(name string) (writefs.FileWrite, error) {
+	return &testWriteFile{fs: f, name: strings.TrimPrefix(name, vfsPrefix)}, nil
+}
+
+func (f *testWriteFS) Remove(name string) error {
+	f.Lock()
+	defer f.Unlock()
+	name = strings.TrimPrefix(name, vfsPrefix)
+	if _, ok := f.files[name]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(f.files, name)
+	return nil
+}
+
+func (f *testWriteFS) Close() error { return nil }
+
+// testWriteFile adds its content to the vfs when it is closed
+type testWriteFile struct {
+	bytes.Buffer
+	fs   *testWriteFS
+	name string
+}
+
+func (w *testWriteFile) Close() error {
+	w.fs.Lock()
+	defer w.fs.Unlock()
+	w.fs.files[w.name] = &fstest.MapFile{Data: w.Bytes()}
+	return nil
+}
+
+func TestCopyDestinations(t *testing.T) {
+	manager := &testManager{
+		objects: map[string]*pb.Object{
+			"sig-a": {Id: "1", Signature: "sig-a", Size: 1, Checksum: sha512Hex("a")},
+			"sig-b": {Id: "2", Signature: "sig-b", Size: 1, Checksum: sha512Hex("other")},
+		},
+		instances: map[string]*pb.ObjectInstance{
+			"sig-a": {Id: "i1", ObjectId: "1", Path: "vfs://storage/sig-a.zip"},
+			"sig-b": {Id: "i2", ObjectId: "2", Path: "vfs://storage/sig-b.zip"},
+		},
+	}
+	client := newTestClient(t, manager)
+	logger := zerolog.Nop()
+	tests := []struct {
+		name      string
+		signature string
+		to        string
+		existing  string // content of the destination before the copy
+		status    string
+		file      string
+		content   string // content of the destination after the copy, empty if it must not exist
+	}{
+		{name: "vfs", signature: "sig-a", to: "vfs://target/folder", status: copyStatusCopied, file: "vfs://target/folder/sig-a.zip", content: "a"},
+		{name: "vfs trailing slash", signature: "sig-a", to: "vfs://target/folder/", status: copyStatusCopied, file: "vfs://target/folder/sig-a.zip", content: "a"},
+		{name: "vfs existing", signature: "sig-a", to: "vfs://target/folder", existing: "a", status: copyStatusSkipped, file: "vfs://target/folder/sig-a.zip", content: "a"},
+		{name: "vfs outdated", signature: "sig-a", to: "vfs://target/folder", existing: "old", status: copyStatusCopied, file: "vfs://target/folder/sig-a.zip", content: "a"},
+		{name: "vfs checksum mismatch", signature: "sig-b", to: "vfs://target/folder", status: copyStatusError, file: "vfs://target/folder/sig-b.zip"},
+		{name: "stdout", signature: "sig-a", to: stdoutTarget, status: copyStatusCopied, file: stdoutTarget, content: "a"},
+		{name: "stdout checksum mismatch", signature: "sig-b", to: stdoutTarget, status: copyStatusError, file: stdoutTarget, content: "b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vfs := &testWriteFS{files: fstest.MapFS{
+				"storage/sig-a.zip": {Data: []byte("a")},
+				"storage/sig-b.zip": {Data: []byte("b")},
+			}}
+			if test.existing != "" {
+				vfs.files[strings.TrimPrefix(test.file, vfsPrefix)] = &fstest.MapFile{Data: []byte(test.existing)}
+			}
+			options := copyOptions{to: test.to, reporter: progress.Nop()}
+			var result copyResult
+			var content string
+			if test.to == stdoutTarget {
+				content = captureStdout(t, func() {
+					result = copyObject(context.Background(), client, vfs, test.signature, options, &logger)
+				})
+			} else {
+				result = copyObject(context.Background(), client, vfs, test.signature, options, &logger)
+				if file, ok := vfs.files[strings.TrimPrefix(test.file, vfsPrefix)]; ok {
+					content = string(file.Data)
+				}
+			}
+			if result.Status != test.status || result.File != test.file {
+				t.Fatalf("expected %s %s, got %s %s (%s)", test.status, test.file, result.Status, result.File, result.Error)
+			}
+			if content != test.content {
+				t.Errorf("expected content '%s', got '%s'", test.content, content)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f writes to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+	f()
+	writer.Close()
+	return string(<-output)
+}
+
+func TestCreateDestination(t *testing.T) {
+	vfs := &testWriteFS{files: fstest.MapFS{}}
+	local := filepath.Join(t.TempDir(), "sig-a.zip")
+	for _, fullPath := range []string{local, "vfs://target/sig-a.zip"} {
+		t.Run(fullPath, func(t *testing.T) {
+			fp, err := createDestination(vfs, fullPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fp.Write([]byte("a")); err != nil {
+				t.Fatal(err)
+			}
+			if err := fp.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := checksumExisting(context.Background(), vfs, fullPath, progress.Nop()); err != nil {
+				t.Fatalf("destination was not written: %v", err)
+			}
+			if err := removeDestination(vfs, fullPath); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := checksumExisting(context.Background(), vfs, fullPath, progress.Nop()); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("destination should be removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteSidecars(t *testing.T) {
+	objectPb := &pb.Object{Id: "1", Signature: "alma:1", Size: 1, Checksum: sha512Hex("a")}
+	manager := &testManager{
+		objects: map[string]*pb.Object{"alma:1": objectPb},
+		instances: map[string]*pb.ObjectInstance{
+			"alma:1": {Id: "i1", ObjectId: "1", Path: "storage/alma_1.zip", StoragePartitionId: "p1"},
+		},
+		named: map[string][]*pb.ObjectInstance{
+			// ingested before the encoding of signatures, listed under the legacy name
+			"alma_1.zip": {
+				{Id: "i1", ObjectId: "1", Path: "storage/alma_1.zip", StoragePartitionId: "p1"},
+				{Id: "i2", ObjectId: "1", Path: "tape/alma_1.zip", StoragePartitionId: "p2"},
+				{Id: "i3", ObjectId: "2", Path: "tape/other/alma_1.zip", StoragePartitionId: "p2"},
+			},
+		},
+		resulting: map[string]int64{"1": 8},
+		needed:    map[string]int64{"1": 6},
+		locations: map[string]models.StorageLocation{
+			"p1": {Id: "l1", Alias: "disk", Quality: 4},
+			"p2": {Id: "l2", Alias: "tape", Quality: 4},
+		},
+		lastChecks: map[string]models.ObjectInstanceCheck{
+			"i2": {Id: "c1", Checktime: "2026-01-01", Error: true, Message: "checksum mismatch", ObjectInstanceId: "i2"},
+		},
+	}
+	client := newTestClient(t, manager)
+	folder := t.TempDir()
+	logger := zerolog.Nop()
+	storage := fstest.MapFS{"storage/alma_1.zip": {Data: []byte("a")}}
+	options := copyOptions{path: folder, metadata: true, reporter: progress.Nop()}
+	result := copyObject(context.Background(), client, storage, "alma:1", options, &logger)
+	if result.Status != copyStatusCopied {
+		t.Fatalf("expected %s, got %s (%s)", copyStatusCopied, result.Status, result.Error)
+	}
+
+	data, err := os.ReadFile(filepath.Join(folder, "alma+1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar := objectSidecar{}
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Object == nil || sidecar.Object.Signature != "alma:1" || sidecar.Storage != testStorage {
+		t.Errorf("unexpected object %v of storage %s", sidecar.Object, sidecar.Storage)
+	}
+	if sidecar.Resulting != 8 || sidecar.Needed != 6 {
+		t.Errorf("expected quality 8/6, got %d/%d", sidecar.Resulting, sidecar.Needed)
+	}
+	tests := []struct {
+		id        string
+		location  string
+		lastCheck bool
+	}{
+		{id: "i1", location: "disk"},
+		{id: "i2", location: "tape", lastCheck: true},
+	}
+	if len(sidecar.Instances) != len(tests) {
+		t.Fatalf("expected %d instances, got %v", len(tests), sidecar.Instances)
+	}
+	for index, test := range tests {
+		instance := sidecar.Instances[index]
+		if instance.Id != test.id || instance.Location != test.location || (instance.LastCheck != nil) != test.lastCheck {
+			t.Errorf("expected instance %s at %s, got %v", test.id, test.location, instance)
+		}
+	}
+
+	checksum, err := service.ReadChecksumFile(filepath.Join(folder, "alma+1.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != sha512Hex("a") {
+		t.Errorf("expected checksum %s, got %s", sha512Hex("a"), checksum)
+	}
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/service"
+)
+
+// describeError adds a hint to errors of the manager API, so the operator knows what to do
+func describeError(err error) string {
+	switch {
+	case errors.Is(err, service.ErrUnauthorized):
+		return err.Error() + "\nThe archive rejected the credentials, check the auth settings, jwt-key and key in the configuration or run ona login"
+	case errors.Is(err, service.ErrNotFound):
+		return err.Error() + "\nThe requested entry does not exist in the archive"
+	case errors.Is(err, service.ErrConflict):
+		return err.Error() + "\nThe entry already exists or is changed by another process"
+	case errors.Is(err, service.ErrUnavailable):
+		return err.Error() + "\nThe archive is not reachable, check status-url and url in the configuration or try again later"
+	}
+	return err.Error()
+}
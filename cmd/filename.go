@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+var filenameCmd = &cobra.Command{
+	Use:   "filename",
+	Short: "Convert between signatures and file names",
+	Long: `Convert between signatures and the file names used by ingest and copy.
+	Signatures are encoded reversibly, so every restored file can be matched to its archive record.
+	File names which are not encoded signatures are reported and ona exits with a non-zero code.
+	Objects ingested before the encoding have names in which every character except -_.a-zA-Z0-9 is replaced
+	by _, audit and stored fall back to these names if a name is not an encoded signature.
+	For example:
+	ona filename encode alma:1234/5.6
+	prints alma+1234=5,6
+	ona filename decode alma+1234=5,6.zip
+	prints alma:1234/5.6
+	`,
+}
+
+var filenameEncodeCmd = &cobra.Command{
+	Use:   "encode <signature>...",
+	Short: "Encode signatures to file names",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   encodeFilename,
+}
+
+var filenameDecodeCmd = &cobra.Command{
+	Use:   "decode <filename>...",
+	Short: "Decode file names to signatures",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   decodeFilename,
+}
+
+func init() {
+	rootCmd.AddCommand(filenameCmd)
+	filenameCmd.AddCommand(filenameEncodeCmd)
+	filenameCmd.AddCommand(filenameDecodeCmd)
+}
+
+func encodeFilename(cmd *cobra.Command, args []string) {
+	for _, signature := range args {
+		fmt.Println(service.EncodeSignature(signature))
+	}
+}
+
+func decodeFilename(cmd *cobra.Command, args []string) {
+	for _, fileName := range args {
+		signature, err := service.SignatureFromFileName(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot decode '%s': %v\n", fileName, err)
+			markFailed()
+			continue
+		}
+		fmt.Println(signature)
+	}
+}
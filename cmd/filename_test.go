@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileNameSignatures(t *testing.T) {
+	tests := []struct {
+		fileName   string
+		signatures []string
+	}{
+		{"alma1234.zip", []string{"alma1234"}},
+		{"/mnt/alma+1234=5,6.zip", []string{"alma:1234/5.6"}},
+		{"/mnt/alma_1234_5.6.zip", []string{"alma_1234_5", "alma_1234_5.6"}},
+		{"alma 1234.zip", nil},
+	}
+	for _, test := range tests {
+		if signatures := fileNameSignatures(test.fileName); !reflect.DeepEqual(signatures, test.signatures) {
+			t.Errorf("fileNameSignatures(%q) = %q, expected %q", test.fileName, signatures, test.signatures)
+		}
+	}
+}
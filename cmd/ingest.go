@@ -1,42 +1,14 @@
 package cmd
 
 import (
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
 
-	"github.com/eventials/go-tus"
-	"github.com/je4/filesystem/v3/pkg/osfsrw"
-	"github.com/je4/filesystem/v3/pkg/writefs"
-	"github.com/je4/filesystem/v3/pkg/zipfs"
-	checksumImp "github.com/je4/utils/v2/pkg/checksum"
-	"github.com/je4/utils/v2/pkg/zLogger"
-	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
-	gocflCmd "github.com/ocfl-archive/gocfl/v2/gocfl/cmd"
-	"github.com/ocfl-archive/gocfl/v2/pkg/ocfl"
+	"emperror.dev/errors"
 	"github.com/ocfl-archive/ona/models"
-	"github.com/ocfl-archive/ona/service"
-	"github.com/schollz/progressbar/v3"
+	"github.com/ocfl-archive/ona/pkg/ingest"
+	"github.com/ocfl-archive/ona/pkg/progress"
 	"github.com/spf13/cobra"
-	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
-	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
-)
-
-const (
-	initialCopying = "initial copying"
-	archived       = "archived"
-	errorStatus    = "error"
-	checksumType   = "sha512"
-	separator      = " *"
 )
 
 var generateCmd = &cobra.Command{
@@ -68,383 +40,103 @@ func sendFile(cmd *cobra.Command, args []string) {
 	background, err := cmd.Flags().GetBool("background")
 	if err != nil {
 		fmt.Println(err)
+		markFailed()
 		return
 	}
-	cfgFilePath, err := cmd.Flags().GetString("config")
+	configObj, err := loadConfig(cmd)
 	if err != nil {
 		fmt.Println(err)
+		markFailed()
 		return
 	}
-	hostname, err := os.Hostname()
+	logger, closeLogger, err := newLogger(cmd, configObj)
 	if err != nil {
-		log.Fatalf("cannot get hostname: %v", err)
-	}
-	configObj := service.GetConfig(cfgFilePath)
-	var loggerTLSConfig *tls.Config
-	var loggerLoader io.Closer
-	if configObj.Log.Stash.TLS != nil {
-		loggerTLSConfig, loggerLoader, err = loader.CreateClientLoader(configObj.Log.Stash.TLS, nil)
-		if err != nil {
-			log.Fatalf("cannot create client loader: %v", err)
-		}
-		defer loggerLoader.Close()
+		fmt.Println(err)
+		markFailed()
+		return
 	}
-	_logger, _logstash, _logfile, err := ublogger.CreateUbMultiLoggerTLS(configObj.Log.Level, configObj.Log.File,
-		ublogger.SetDataset(configObj.Log.Stash.Dataset),
-		ublogger.SetLogStash(configObj.Log.Stash.LogstashHost, configObj.Log.Stash.LogstashPort, configObj.Log.Stash.Namespace, configObj.Log.Stash.LogstashTraceLevel),
-		ublogger.SetTLS(configObj.Log.Stash.TLS != nil),
-		ublogger.SetTLSConfig(loggerTLSConfig),
-	)
-
+	defer closeLogger()
+	defer startMetrics(configObj.Metrics, logger)()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
 	if err != nil {
-		log.Fatalf("cannot create logger: %v", err)
-	}
-
-	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
-	var logger zLogger.ZLogger = &l2
-	if _logstash != nil {
-		defer _logstash.Close()
-	}
-	if _logfile != nil {
-		defer _logfile.Close()
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
 	}
+	defer endTracing()
 
 	quiet, err := cmd.Flags().GetBool("quiet")
 	if err != nil {
-		logger.Error().Msgf(err.Error())
+		logger.Error().Msgf("%v", err)
+		markFailed()
 		return
 	}
 	force, err := cmd.Flags().GetBool("force")
 	if err != nil {
-		logger.Error().Msgf(err.Error())
+		logger.Error().Msgf("%v", err)
+		markFailed()
 		return
 	}
-
-	filePathRaw, _ := cmd.Flags().GetString("path")
-	if filePathRaw == "" {
+	filePath, _ := cmd.Flags().GetString("path")
+	if filePath == "" {
 		logger.Error().Msgf("You should should specify path")
+		markFailed()
 		return
 	}
-	filePathCleaned := filepath.ToSlash(filepath.Clean(filePathRaw))
-
-	file, err := os.Open(filePathCleaned)
-	if err != nil {
-		logger.Error().Msgf("could not open file: " + filePathRaw)
-		return
-	}
-	defer file.Close()
-
-	fileInfo, err := os.Stat(filePathCleaned)
+	jsonPath, err := cmd.Flags().GetString("json")
 	if err != nil {
-		logger.Error().Msgf("cannot read file: %v", err)
+		logger.Error().Msgf("%v", err)
+		markFailed()
 		return
 	}
-	objectSize := fileInfo.Size()
 
-	jsonPathRow, err := cmd.Flags().GetString("json")
+	ingester, err := ingest.NewIngester(*configObj, logger)
 	if err != nil {
-		logger.Error().Msgf(err.Error())
+		logger.Error().Msgf("%v", err)
+		markFailed()
 		return
 	}
-	checksum := ""
-	if force {
-		targetFP := io.Discard
-		csWriter, err := checksumImp.NewChecksumWriter(
-			[]checksumImp.DigestAlgorithm{checksumType},
-			targetFP,
-		)
-		_, err = io.Copy(csWriter, file)
-		if err != nil {
-			logger.Error().Msgf(err.Error())
-			return
-		}
-		if err := csWriter.Close(); err != nil {
-			logger.Error().Msgf("cannot close checksum writer %s", err)
-			return
-		}
-		checksums, err := csWriter.GetChecksums()
-		if err != nil {
-			logger.Error().Msgf("cannot get checksum %s", err)
-		}
-		checksum = checksums[checksumType]
-	} else {
-		fileChecksum, err := os.ReadFile(filePathCleaned + "." + checksumType)
-		if err == nil {
-			checksum = strings.Split(string(fileChecksum), separator)[0]
-		} else {
-			logger.Error().Msgf("You should have a checksum file in the folder or use -f flag to produce the checksum ")
-			return
-		}
-	}
-
-	fsFactory, err := writefs.NewFactory()
-	if err != nil {
-		logger.Error().Msgf("cannot create filesystem factory %s", err)
-		return
-	}
-	if err := fsFactory.Register(zipfs.NewCreateFSFunc(logger), "\\.zip$", writefs.HighFS); err != nil {
-		logger.Error().Msgf("cannot register zipfs %s", err)
-		return
-	}
-	if err := fsFactory.Register(osfsrw.NewCreateFSFunc(logger), "", writefs.LowFS); err != nil {
-		logger.Error().Msgf("cannot register zipfs %s", err)
-		return
-	}
-	extensionFactory, err := gocflCmd.InitExtensionFactory(map[string]string{},
-		"",
-		false,
-		nil,
-		nil,
-		nil,
-		nil,
-		logger,
-		"")
-	if err != nil {
-		logger.Error().Msgf("cannot instantiate extension factory %s", err)
-		return
-	}
-
-	objectJson := ""
-	jsonPathCleaned := ""
-	sendTwoFiles := false
-	object := models.Object{}
-	objectOcfl := ocfl.StorageRootMetadata{}
-	if jsonPathRow != "" {
-		jsonPathCleaned = filepath.ToSlash(filepath.Clean(jsonPathRow))
-		jsonObject, err := os.ReadFile(jsonPathCleaned)
-		if err != nil {
-			logger.Error().Msgf("could not open json file: " + jsonPathCleaned)
-			return
-		}
-		err = json.Unmarshal(jsonObject, &objectOcfl)
-		if err != nil {
-			logger.Error().Msgf(err.Error())
-			return
-		}
-		if objectOcfl.Objects != nil {
-			object, err = service.GetObjectFromGocflObject(&objectOcfl)
-			if err != nil {
-				logger.Error().Msgf(err.Error())
-				return
-			}
-			sendTwoFiles = true
-		} else {
-			err = json.Unmarshal(jsonObject, &object)
-			if err != nil {
-				logger.Error().Msgf(err.Error())
-				return
-			}
-		}
-		object.Binary = true
-	} else {
-		gocfl := service.NewGocfl(extensionFactory, fsFactory, logger)
-		object, err = gocfl.ExtractMetadata(filePathCleaned)
-		if err != nil {
-			logger.Error().Msgf("could not extract metadata for file: " + filePathCleaned)
-			return
-		}
-		object.Binary = false
-	}
-	object.Checksum = checksum
-	object.Size = objectSize
-	var uploads []*os.File
-	if sendTwoFiles && jsonPathCleaned != "" {
-		jsonFile, err := os.Open(jsonPathCleaned)
-		if err != nil {
-			logger.Error().Msgf("could not open file: " + jsonPathCleaned)
-			return
-		}
-		defer jsonFile.Close()
-		if jsonFile != nil {
-			uploads = append(uploads, jsonFile)
-		}
-	}
-	uploads = append(uploads, file)
-
-	re := regexp.MustCompile(`[^-_.a-zA-Z0-9]`)
-	objectPb, err := service.GetObjectBySignature(object.Signature, *configObj)
-	if err != nil {
-		logger.Error().Msgf("could not GetObjectBySignature %s", err)
-		return
-	}
-
-	head := "v1"
-	if objectPb.Id != "" {
-		objectInstancePb, err := service.CheckRawObjectInstanceByObjectId(objectPb.Id, *configObj)
-		if err != nil {
-			logger.Error().Msgf("could not GetObjectBySignature %s", err)
-			return
-		}
-		if objectInstancePb.Id == "" {
-			objects, err := service.GetObjectsByChecksum(checksum, *configObj)
-			if err != nil {
-				logger.Error().Msgf("could not get objects from database to check whether object with checksum %s exists", checksum)
-				return
-			}
-			if len(objects.Objects) != 0 {
-				logger.Error().Msgf("The file with checksum: %s you are trying to archive already exists in archive\n", checksum)
-				return
-			}
-			head = "v+"
-		}
-		object.Id = objectPb.Id
-	}
-	//checking whether needed amount of locations is available, if yes, delivering partitionId of first location to copy in
-	partitionId, err := service.GetStorageLocationsStatusForCollectionAlias(object.CollectionId, objectSize, object.Signature, head, *configObj)
-	if err != nil {
-		logger.Error().Msgf("could not get GetStorageLocationsStatusForCollectionAlias %s", err)
-		return
-	}
-	r := regexp.MustCompile("^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$")
-	if !r.MatchString(partitionId) {
-		logger.Error().Msgf("could not get StoragePartition for collection with alias %s", object.Collection)
-		return
-	}
-
-	archivedStatus, err := service.CreateStatus(models.ArchivingStatus{Status: initialCopying}, *configObj)
-	if err != nil {
-		logger.Error().Msgf("could not create initial status")
-		return
-	}
-	ObjectJsonRaw, err := json.Marshal(object)
-	if err != nil {
-		logger.Error().Msgf(err.Error())
-		return
-	}
-	objectJson = string(ObjectJsonRaw)
-	defaultTransport := http.DefaultTransport.(*http.Transport)
-
-	// Create new Transport that ignores self-signed SSL
-	customTransport := &http.Transport{
-		Proxy:                 defaultTransport.Proxy,
-		DialContext:           defaultTransport.DialContext,
-		MaxIdleConns:          defaultTransport.MaxIdleConns,
-		IdleConnTimeout:       defaultTransport.IdleConnTimeout,
-		ExpectContinueTimeout: defaultTransport.ExpectContinueTimeout,
-		TLSHandshakeTimeout:   defaultTransport.TLSHandshakeTimeout,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
-	}
-	httpClient := &http.Client{Transport: customTransport}
-
-	for index, tusUpload := range uploads {
-		path := ""
-		severalObjects := ""
-		if len(uploads) > 1 {
-			severalObjects = strconv.Itoa(index)
-		}
-		if len(uploads) > 1 && index == 0 {
-			path = jsonPathCleaned
-		} else {
-			path = filePathCleaned
-		}
-		extension := filepath.Ext(path)
-		fileName := re.ReplaceAllString(object.Signature+extension, "_")
-		// create the tus client.
-		client, err := tus.NewClient(configObj.Url, &tus.Config{ChunkSize: configObj.ChunkSize, Header: map[string][]string{"Authorization": {configObj.Key},
-			"ObjectJson": {objectJson}, "Collection": {object.CollectionId}, "StatusId": {archivedStatus.Id}, "Checksum": {checksum}, "FileName": {fileName}, "PartitionId": {partitionId}, "SeveralObjects": {severalObjects}}, HttpClient: httpClient})
-		if err != nil {
-			logger.Error().Msgf("could not create client for: " + configObj.Url)
-			return
-		}
-
-		// create an upload from a file.
-		upload, err := tus.NewUploadFromFile(tusUpload)
-		if err != nil {
-			logger.Error().Msgf("could not upload file: " + path)
-			return
-		}
-		// create the uploader.
-		uploader, err := client.CreateUpload(upload)
-		if err != nil {
-			logger.Error().Msgf("could not create upload for file: " + path + ", with err: " + err.Error())
-			return
-		}
-		if object.Id == "" {
-			objectWithInfo := &pb.ObjectAndFile{}
-			objectPbF := &pb.Object{}
-			//statusId field is used to transfer partition id
-			objectWithInfo.StatusId = partitionId
-			objectWithInfo.FileName = fileName
-
-			objectPbF.Size = object.Size
-			objectPbF.Signature = object.Signature
-			objectPbF.CollectionId = object.CollectionId
-			objectPbF.Collection = object.Collection
-			objectPbF.Binary = object.Binary
-			objectPbF.Address = object.Address
-			objectPbF.AlternativeTitles = object.AlternativeTitles
-			objectPbF.Checksum = object.Checksum
-			objectPbF.Authors = object.Authors
-			objectPbF.Description = object.Description
-			objectPbF.Keywords = object.Keywords
-			objectPbF.Created = object.Created
-			objectPbF.Expiration = object.Expiration
-			objectPbF.Head = head
-			objectPbF.Holding = object.Holding
-			objectPbF.Identifiers = object.Identifiers
-			objectPbF.IngestWorkflow = object.IngestWorkflow
-			objectPbF.LastChanged = object.LastChanged
-			objectPbF.References = object.References
-			objectPbF.Sets = object.Sets
-			objectPbF.Title = object.Title
-			objectPbF.User = object.User
-			objectWithInfo.Object = objectPbF
-
-			err = service.CreateObjectAndInstance(objectWithInfo, *configObj)
-			if err != nil {
-				logger.Error().Msgf(err.Error())
-				return
-			}
-		}
-
-		if !quiet {
-			// start the uploading process.
-			go func() {
-				uploader.Upload()
-			}()
-			fmt.Println("Upload...")
-			bar := progressbar.NewOptions64(
-				upload.Size(),
-				progressbar.OptionSetDescription(""),
-				progressbar.OptionSetWriter(os.Stdout),
-				progressbar.OptionSetWidth(10),
-				progressbar.OptionThrottle(65*time.Millisecond),
-				progressbar.OptionOnCompletion(func() {
-					fmt.Fprint(os.Stdout, "\nUpload to temporary location is finished. Upload Id: "+archivedStatus.Id+" \n")
-				}),
-				progressbar.OptionSpinnerType(14),
-				progressbar.OptionFullWidth(),
-				progressbar.OptionSetRenderBlankState(true),
-			)
-
-			size := upload.Size()
-			for {
-				if upload.Finished() {
-					bar.Set(int(size))
-					break
+	options := ingest.Options{
+		ComputeChecksum: force,
+		Wait:            !background,
+		Hooks: ingest.Hooks{
+			BeforeUpload: func(ctx context.Context, object *models.Object) error {
+				if !confirm(cmd, configObj, fmt.Sprintf("ingest %s as %s", filePath, object.Signature)) {
+					return ingest.ErrCancelled
 				}
-				offset := upload.Offset()
-				bar.Set(int(offset))
-			}
-		} else {
-			uploader.Upload()
-		}
-	}
-
-	if !background {
-		for {
-			archivedStatusW, err := service.GetStatus(archivedStatus.Id, *configObj)
-			if err != nil {
-				logger.Error().Msgf("could not get initial status with Id: " + archivedStatus.Id)
-				return
-			}
-			if archivedStatusW.Status != archived && archivedStatusW.Status != errorStatus {
-				time.Sleep(10 * time.Second)
-			} else {
-				fmt.Printf("Status of upload: %s", archivedStatusW.Status)
-				break
-			}
-		}
-
+				return nil
+			},
+			AfterUpload: func(ctx context.Context, result ingest.Result) error {
+				if !quiet {
+					fmt.Printf("Upload to temporary location is finished. Upload Id: %s\n", result.StatusId)
+				}
+				return nil
+			},
+		},
+	}
+	if quiet {
+		options.Progress = progress.Nop()
+	} else if options.Progress, err = newReporter(cmd, logger, false); err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	result, err := ingester.Ingest(cmd.Context(), ingest.Source{Path: filePath, MetadataPath: jsonPath}, options)
+	switch {
+	case errors.Is(err, ingest.ErrCancelled):
+		logger.Info().Msgf("ingest of %s cancelled", filePath)
+	case errors.Is(err, ingest.ErrChecksumMissing):
+		logger.Error().Msgf("You should have a checksum file in the folder or use -f flag to produce the checksum ")
+		markFailed()
+	case err != nil && result.Status == ingest.StatusAborted:
+		logger.Error().Msgf("upload of %s was cancelled, status %s stays at %s", filePath, result.StatusId, ingest.StatusInitialCopying)
+		markFailed()
+	case errors.Is(err, ingest.ErrStoppedWaiting):
+		logger.Info().Msgf("stopped waiting for status %s, the archiving continues on the server", result.StatusId)
+	case err != nil:
+		logger.Error().Msgf("cannot ingest %s: %s", filePath, describeError(err))
+		markFailed()
+	case !background:
+		fmt.Printf("Status of upload: %s", result.Status)
 	}
 }
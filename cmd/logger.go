@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+	"github.com/spf13/cobra"
+	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+// newLogger creates the logger of the log section of the configuration. Every run gets a new correlation id,
+// which is added to every log line and to the context of cmd. The returned function closes the logstash
+// connection and the log file and has to be called when the command ends.
+func newLogger(cmd *cobra.Command, configObj *configuration.Config) (zLogger.ZLogger, func(), error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get hostname")
+	}
+	var closers []io.Closer
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
+	var loggerTLSConfig *tls.Config
+	if configObj.Log.Stash.TLS != nil {
+		var loggerLoader io.Closer
+		loggerTLSConfig, loggerLoader, err = loader.CreateClientLoader(configObj.Log.Stash.TLS, nil)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot create client loader")
+		}
+		closers = append(closers, loggerLoader)
+	}
+	_logger, _logstash, _logfile, err := ublogger.CreateUbMultiLoggerTLS(configObj.Log.Level, configObj.Log.File,
+		ublogger.SetDataset(configObj.Log.Stash.Dataset),
+		ublogger.SetLogStash(configObj.Log.Stash.LogstashHost, configObj.Log.Stash.LogstashPort, configObj.Log.Stash.Namespace, configObj.Log.Stash.LogstashTraceLevel),
+		ublogger.SetTLS(configObj.Log.Stash.TLS != nil),
+		ublogger.SetTLSConfig(loggerTLSConfig),
+	)
+	if err != nil {
+		closeAll()
+		return nil, nil, errors.Wrap(err, "cannot create logger")
+	}
+	if _logstash != nil {
+		closers = append(closers, _logstash)
+	}
+	if _logfile != nil {
+		closers = append(closers, _logfile)
+	}
+	correlationId := correlation.NewId()
+	cmd.SetContext(correlation.WithId(cmd.Context(), correlationId))
+	l2 := _logger.With().Timestamp().Str("host", hostname).Str(correlation.LogField, correlationId).Logger() //.Output(output)
+	return &l2, closeAll, nil
+}
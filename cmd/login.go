@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in at the OIDC issuer",
+	Long: `Log in at the OIDC issuer configured in the oidc section of the configuration.
+	The tokens are stored in a credential cache readable only for the current user and are used
+	for all requests to the archive until ona logout is called.
+	For example:
+	ona login -c C:\Users\config.yml
+	`,
+	Run: login,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the cached credentials",
+	Long: `Remove the credentials of the configured OIDC issuer from the credential cache.
+	For example:
+	ona logout -c C:\Users\config.yml
+	`,
+	Run: logout,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+}
+
+func login(cmd *cobra.Command, args []string) {
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	oidc, err := service.NewOIDC(*configObj)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	credentials, err := oidc.Login(cmd.Context(), os.Stdout)
+	if err != nil {
+		logger.Error().Msgf("cannot log in at %s: %v", configObj.OIDC.Issuer, err)
+		markFailed()
+		return
+	}
+	fmt.Printf("Logged in at %s, token valid until %s\n", credentials.Issuer, credentials.Expiry.Format("2006-01-02 15:04:05"))
+}
+
+func logout(cmd *cobra.Command, args []string) {
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	oidc, err := service.NewOIDC(*configObj)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	if err := oidc.Logout(); err != nil {
+		logger.Error().Msgf("cannot log out from %s: %v", configObj.OIDC.Issuer, err)
+		markFailed()
+		return
+	}
+	fmt.Printf("Logged out from %s\n", configObj.OIDC.Issuer)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/service"
+)
+
+const testStorage = "test-storage"
+
+// testManager answers the routes of the manager used by copy, stored, report and audit from its maps.
+// Missing entries are answered with not found.
+type testManager struct {
+	objects    map[string]*pb.Object                 // by signature
+	instances  map[string]*pb.ObjectInstance         // instance on the storage of the configuration by signature
+	named      map[string][]*pb.ObjectInstance       // instances of all locations by file name
+	checksums  map[string][]*pb.Object               // by checksum
+	resulting  map[string]int64                      // resulting quality by object id
+	needed     map[string]int64                      // needed quality by object id
+	locations  map[string]models.StorageLocation     // by partition id, nil if the manager has no partition route
+	lastChecks map[string]models.ObjectInstanceCheck // by object instance id, nil if the manager has no check route
+	absent     int                                   // status code of the routes the manager has not, not found if 0
+}
+
+// newTestClient starts the manager and returns a client without retries using it
+func newTestClient(t *testing.T, manager *testManager) *service.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /object/signature/{signature}", func(w http.ResponseWriter, r *http.Request) {
+		writeTestEntry(w, manager.objects, r.PathValue("signature"))
+	})
+	mux.HandleFunc("GET /object/{checksum}", func(w http.ResponseWriter, r *http.Request) {
+		objects, ok := manager.checksums[r.PathValue("checksum")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&pb.Objects{Objects: objects})
+	})
+	mux.HandleFunc("GET /object/resulting-quality/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeTestQuality(w, r, manager.resulting)
+	})
+	mux.HandleFunc("GET /object/needed-quality/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeTestQuality(w, r, manager.needed)
+	})
+	mux.HandleFunc("GET /object-instance/signature-and-location/{signature}/{storage}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("storage") != testStorage {
+			http.NotFound(w, r)
+			return
+		}
+		writeTestEntry(w, manager.instances, r.PathValue("signature"))
+	})
+	mux.HandleFunc("GET /object-instance/{name}", func(w http.ResponseWriter, r *http.Request) {
+		instances, ok := manager.named[r.PathValue("name")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&pb.ObjectInstances{ObjectInstances: instances})
+	})
+	absent := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(manager.absent), manager.absent)
+	}
+	switch {
+	case manager.locations != nil:
+		mux.HandleFunc("GET /storage-location/partition/{id}", func(w http.ResponseWriter, r *http.Request) {
+			writeTestEntry(w, manager.locations, r.PathValue("id"))
+		})
+	case manager.absent != 0:
+		mux.HandleFunc("GET /storage-location/partition/{id}", absent)
+	}
+	switch {
+	case manager.lastChecks != nil:
+		mux.HandleFunc("GET /object-instance-check/last/{id}", func(w http.ResponseWriter, r *http.Request) {
+			writeTestEntry(w, manager.lastChecks, r.PathValue("id"))
+		})
+	case manager.absent != 0:
+		mux.HandleFunc("GET /object-instance-check/last/{id}", absent)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client, err := service.NewClient(configuration.Config{
+		StatusUrl: server.URL,
+		JwtKey:    "test",
+		Retries:   -1,
+		Storage:   configuration.Storage{Name: testStorage},
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %v", err)
+	}
+	return client
+}
+
+func writeTestEntry[T any](w http.ResponseWriter, entries map[string]T, key string) {
+	entry, ok := entries[key]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+func writeTestQuality(w http.ResponseWriter, r *http.Request, qualities map[string]int64) {
+	quality, ok := qualities[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(&pb.SizeAndId{Size: quality, Id: r.PathValue("id")})
+}
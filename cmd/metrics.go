@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+)
+
+const metricsPath = "/metrics"
+
+// startMetrics serves the metrics on metrics.addr. The returned function stops the server and writes the
+// metrics to metrics.textfile, it has to be called when the command ends.
+func startMetrics(metricsConfig configuration.Metrics, logger zLogger.ZLogger) func() {
+	var server *http.Server
+	if metricsConfig.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET "+metricsPath, metrics.Handler())
+		server = &http.Server{Addr: metricsConfig.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error().Msgf("cannot serve metrics on %s: %v", metricsConfig.Addr, err)
+			}
+		}()
+		logger.Info().Msgf("serving metrics on http://%s%s", metricsConfig.Addr, metricsPath)
+	}
+	return func() {
+		if server != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}
+		if metricsConfig.Textfile != "" {
+			if err := metrics.WriteTextfile(metricsConfig.Textfile); err != nil {
+				logger.Error().Msgf("cannot write metrics to '%s': %v", metricsConfig.Textfile, err)
+			}
+		}
+	}
+}
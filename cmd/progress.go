@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/spf13/cobra"
+)
+
+const (
+	progressAuto = "auto"
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressLog  = "log"
+	progressNone = "none"
+)
+
+// newReporter creates the progress reporter selected with --progress. auto shows a bar on terminals for
+// sequential tasks and writes log lines otherwise. Bar and JSON events are written to stderr, so stdout stays
+// usable for data.
+func newReporter(cmd *cobra.Command, logger zLogger.ZLogger, concurrent bool) (progress.Reporter, error) {
+	mode, err := cmd.Flags().GetString("progress")
+	if err != nil {
+		return nil, err
+	}
+	if mode == progressAuto {
+		mode = progressLog
+		if fileInfo, err := os.Stderr.Stat(); err == nil && fileInfo.Mode()&os.ModeCharDevice != 0 && !concurrent {
+			mode = progressBar
+		}
+	}
+	switch mode {
+	case progressBar:
+		return progress.NewBar(os.Stderr), nil
+	case progressJSON:
+		return progress.NewJSON(os.Stderr), nil
+	case progressLog:
+		return progress.NewLog(logger, progress.DefaultLogInterval), nil
+	case progressNone:
+		return progress.Nop(), nil
+	}
+	return nil, errors.Errorf("unknown progress '%s', use auto, bar, json, log or none", mode)
+}
@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+const (
+	reportFormatCSV  = "csv"
+	reportFormatJSON = "json"
+	reportFormatHTML = "html"
+)
+
+//go:embed report_collection.html
+var collectionReportPage string
+
+var collectionReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(collectionReportPage))
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Preservation reports",
+	Long: `Preservation reports of the archive.
+	`,
+}
+
+var reportCollectionCmd = &cobra.Command{
+	Use:   "collection <alias>",
+	Short: "Compliance report of the objects of a collection",
+	Long: `List every object of a collection with the number of storage locations holding a copy and the resulting
+	and needed quality. Objects with a resulting quality below the needed quality, objects with a failed fixity
+	check and objects changed in the last days are flagged. The report is written as csv, json or a
+	self-contained html page. The DLZA manager cannot list the objects of a collection, the signatures of the
+	objects are read from the file given with --list, one per line. report exits with a non-zero code if an
+	object could not be checked.
+	For example:
+	ona report collection test-collection -l signatures.txt --format html -o report.html -c C:\Users\config.yml
+	`,
+	Args: cobra.ExactArgs(1),
+	Run:  reportCollection,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportCollectionCmd)
+	reportCollectionCmd.Flags().StringP("list", "l", "", "Path to file with the signatures of the collection, one per line")
+	reportCollectionCmd.Flags().String("format", reportFormatCSV, "Output format: csv, json or html")
+	reportCollectionCmd.Flags().StringP("output", "o", "", "Path to report file, stdout if empty")
+	reportCollectionCmd.Flags().Int("recent-days", 30, "Objects changed within this number of days are flagged as recently changed")
+	reportCollectionCmd.Flags().IntP("workers", "w", 4, "Number of objects checked in parallel")
+}
+
+// collectionReport is the compliance report of a collection
+type collectionReport struct {
+	Collection      string            `json:"collection"`
+	Generated       time.Time         `json:"generated"`
+	RecentSince     time.Time         `json:"recent-since"`
+	Objects         int               `json:"objects"`
+	Size            int64             `json:"size"`
+	UnderReplicated int               `json:"under-replicated"`
+	FailedChecks    int               `json:"failed-checks"`
+	RecentlyChanged int               `json:"recently-changed"`
+	Errors          int               `json:"errors"`
+	Entries         []collectionEntry `json:"entries"`
+}
+
+// collectionEntry is an object of the collection report
+type collectionEntry struct {
+	Signature       string `json:"signature"`
+	ObjectId        string `json:"object-id"`
+	Title           string `json:"title,omitempty"`
+	Size            int64  `json:"size"`
+	LastChanged     string `json:"last-changed,omitempty"`
+	Copies          int    `json:"copies"`
+	Resulting       int64  `json:"resulting-quality"`
+	Needed          int64  `json:"needed-quality"`
+	UnderReplicated bool   `json:"under-replicated"`
+	FailedChecks    int    `json:"failed-checks"`
+	RecentlyChanged bool   `json:"recently-changed"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Flagged is true if the object needs attention
+func (e collectionEntry) Flagged() bool {
+	return e.UnderReplicated || e.FailedChecks > 0 || e.RecentlyChanged || e.Error != ""
+}
+
+func reportCollection(cmd *cobra.Command, args []string) {
+	alias := args[0]
+	listPath, _ := cmd.Flags().GetString("list")
+	format, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+	recentDays, _ := cmd.Flags().GetInt("recent-days")
+	workers, _ := cmd.Flags().GetInt("workers")
+	if format != reportFormatCSV && format != reportFormatJSON && format != reportFormatHTML {
+		fmt.Printf("unknown format '%s', use csv, json or html\n", format)
+		markFailed()
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if listPath == "" {
+		fmt.Printf("%v, the signatures of collection %s have to be given with --list\n",
+			errors.Wrap(service.ErrNotSupported, "listing the objects of a collection"), alias)
+		markFailed()
+		return
+	}
+	signatures, err := collectSignatures(nil, listPath, "", "")
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	defer endTracing()
+	client, err := service.NewClient(*configObj)
+	if err != nil {
+		logger.Error().Msgf("cannot create client: %v", err)
+		markFailed()
+		return
+	}
+	ctx := cmd.Context()
+
+	now := time.Now()
+	report := collectionReport{
+		Collection:  alias,
+		Generated:   now,
+		RecentSince: now.AddDate(0, 0, -recentDays),
+		Entries:     make([]collectionEntry, len(signatures)),
+	}
+	locations := newStorageLocations(client)
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				report.Entries[index] = newCollectionEntry(ctx, client, signatures[index], locations, report.RecentSince)
+			}
+		}()
+	}
+	for index := range signatures {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	if ctx.Err() != nil {
+		logger.Error().Msgf("report of collection %s cancelled", alias)
+		markFailed()
+		return
+	}
+	for _, entry := range report.Entries {
+		report.Objects++
+		report.Size += entry.Size
+		if entry.UnderReplicated {
+			report.UnderReplicated++
+		}
+		if entry.FailedChecks > 0 {
+			report.FailedChecks++
+		}
+		if entry.RecentlyChanged {
+			report.RecentlyChanged++
+		}
+		if entry.Error != "" {
+			report.Errors++
+			logger.Error().Msgf("cannot check %s: %s", entry.Signature, entry.Error)
+		}
+	}
+
+	if output == "" {
+		err = writeCollectionReport(os.Stdout, format, report)
+	} else {
+		err = writeCollectionReportFile(output, format, report)
+	}
+	if err != nil {
+		logger.Error().Msgf("cannot write report: %v", err)
+		markFailed()
+		return
+	}
+	logger.Info().Msgf("%d objects of collection %s, %d under-replicated, %d with failed checks, %d recently changed",
+		report.Objects, alias, report.UnderReplicated, report.FailedChecks, report.RecentlyChanged)
+	if report.Errors > 0 {
+		logger.Error().Msgf("%d objects of collection %s could not be checked", report.Errors, alias)
+		markFailed()
+	}
+}
+
+// newCollectionEntry checks the instances of the object with the signature, errors are reported in the entry
+func newCollectionEntry(ctx context.Context, client *service.Client, signature string, locations *storageLocations, recentSince time.Time) collectionEntry {
+	entry := collectionEntry{Signature: signature}
+	if ctx.Err() != nil {
+		entry.Error = "report was cancelled"
+		return entry
+	}
+	objectPb, err := client.GetObjectBySignature(ctx, signature)
+	if errors.Is(err, service.ErrNotFound) {
+		entry.Error = "object does not exist in the archive"
+		return entry
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.ObjectId = objectPb.Id
+	entry.Title = objectPb.Title
+	entry.Size = objectPb.Size
+	entry.LastChanged = objectPb.LastChanged
+	if changed, ok := parseArchiveTime(objectPb.LastChanged); ok {
+		entry.RecentlyChanged = changed.After(recentSince)
+	}
+	object, err := storedObjectOf(ctx, client, objectPb, locations)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.Copies = object.locationCount()
+	entry.Resulting = object.Resulting
+	entry.Needed = object.Needed
+	entry.UnderReplicated = entry.Copies == 0 || object.Resulting < object.Needed
+	for _, instance := range object.Instances {
+		if instance.LastCheck != nil && instance.LastCheck.Error {
+			entry.FailedChecks++
+		}
+	}
+	return entry
+}
+
+// archiveTimeLayouts are the formats of timestamps of the manager
+var archiveTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// parseArchiveTime parses a timestamp of the manager
+func parseArchiveTime(value string) (time.Time, bool) {
+	for _, layout := range archiveTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// writeCollectionReport writes the report in the format
+func writeCollectionReport(w io.Writer, format string, report collectionReport) error {
+	switch format {
+	case reportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case reportFormatHTML:
+		return collectionReportTemplate.Execute(w, report)
+	case reportFormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"signature", "object-id", "title", "size", "last-changed", "copies", "resulting-quality",
+			"needed-quality", "under-replicated", "failed-checks", "recently-changed", "error"})
+		for _, entry := range report.Entries {
+			writer.Write([]string{entry.Signature, entry.ObjectId, entry.Title, strconv.FormatInt(entry.Size, 10),
+				entry.LastChanged, strconv.Itoa(entry.Copies), strconv.FormatInt(entry.Resulting, 10),
+				strconv.FormatInt(entry.Needed, 10), strconv.FormatBool(entry.UnderReplicated),
+				strconv.Itoa(entry.FailedChecks), strconv.FormatBool(entry.RecentlyChanged), entry.Error})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return errors.Errorf("unknown format '%s'", format)
+}
+
+// writeCollectionReportFile writes the report in the format to the file at reportPath
+func writeCollectionReportFile(reportPath string, format string, report collectionReport) error {
+	fp, err := os.Create(reportPath)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create report file '%s'", reportPath)
+	}
+	if err := writeCollectionReport(fp, format, report); err != nil {
+		fp.Close()
+		return err
+	}
+	return errors.Wrapf(fp.Close(), "cannot close report file '%s'", reportPath)
+}
+
+// formatBytes returns size with a decimal unit, e.g. 1.5 GB
+func formatBytes(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+)
+
+func TestNewCollectionEntry(t *testing.T) {
+	recentSince := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		modify    func(manager *testManager)
+		signature string
+		cancelled bool
+		want      collectionEntry
+	}{
+		{
+			name:      "compliant",
+			signature: "alma:1",
+			want:      collectionEntry{Signature: "alma:1", ObjectId: "1", Size: 1, Copies: 2, Resulting: 8, Needed: 6},
+		},
+		{
+			// several instances on one storage location count as one copy
+			name: "instances on one location",
+			modify: func(manager *testManager) {
+				manager.named["alma+1.zip"] = append(manager.named["alma+1.zip"],
+					&pb.ObjectInstance{Id: "i4", ObjectId: "1", Path: "tape/copy/alma+1.zip", StoragePartitionId: "p2"})
+			},
+			signature: "alma:1",
+			want:      collectionEntry{Signature: "alma:1", ObjectId: "1", Size: 1, Copies: 2, Resulting: 8, Needed: 6},
+		},
+		{
+			name: "under-replicated with failed check",
+			modify: func(manager *testManager) {
+				manager.resulting["1"] = 4
+				manager.lastChecks["i2"] = models.ObjectInstanceCheck{Id: "c1", Checktime: "2026-01-01", Error: true, Message: "checksum mismatch"}
+			},
+			signature: "alma:1",
+			want: collectionEntry{Signature: "alma:1", ObjectId: "1", Size: 1, Copies: 2, Resulting: 4, Needed: 6,
+				UnderReplicated: true, FailedChecks: 1},
+		},
+		{
+			name: "recently changed",
+			modify: func(manager *testManager) {
+				manager.objects["alma:1"].LastChanged = "2026-02-01 10:00:00"
+			},
+			signature: "alma:1",
+			want: collectionEntry{Signature: "alma:1", ObjectId: "1", Size: 1, LastChanged: "2026-02-01 10:00:00", Copies: 2,
+				Resulting: 8, Needed: 6, RecentlyChanged: true},
+		},
+		{
+			name: "without instances",
+			modify: func(manager *testManager) {
+				manager.instances = nil
+				manager.named = nil
+			},
+			signature: "alma:1",
+			want:      collectionEntry{Signature: "alma:1", ObjectId: "1", Size: 1, UnderReplicated: true},
+		},
+		{
+			name:      "not in the archive",
+			signature: "alma:2",
+			want:      collectionEntry{Signature: "alma:2", Error: "object does not exist in the archive"},
+		},
+		{
+			name:      "cancelled",
+			signature: "alma:1",
+			cancelled: true,
+			want:      collectionEntry{Signature: "alma:1", Error: "report was cancelled"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := newStoredTestManager()
+			if test.modify != nil {
+				test.modify(manager)
+			}
+			client := newTestClient(t, manager)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelled {
+				cancel()
+			}
+			entry := newCollectionEntry(ctx, client, test.signature, newStorageLocations(client), recentSince)
+			if !reflect.DeepEqual(entry, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, entry)
+			}
+			if entry.Flagged() != (test.want.UnderReplicated || test.want.FailedChecks > 0 || test.want.RecentlyChanged || test.want.Error != "") {
+				t.Errorf("unexpected flag of %+v", entry)
+			}
+		})
+	}
+}
+
+func testCollectionReport() collectionReport {
+	return collectionReport{
+		Collection: "test",
+		Generated:  time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		Objects:    2,
+		Size:       1500,
+		Errors:     1,
+		Entries: []collectionEntry{
+			{Signature: "alma:1", ObjectId: "1", Title: "Letters, 1900", Size: 1500, Copies: 2, Resulting: 8, Needed: 6},
+			{Signature: "alma:2", Error: "object does not exist in the archive"},
+		},
+	}
+}
+
+func TestWriteCollectionReport(t *testing.T) {
+	report := testCollectionReport()
+	tests := []struct {
+		format string
+		check  func(t *testing.T, output string)
+	}{
+		{format: reportFormatCSV, check: func(t *testing.T, output string) {
+			records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 || records[0][0] != "signature" || records[0][5] != "copies" {
+				t.Fatalf("unexpected records %v", records)
+			}
+			want := []string{"alma:1", "1", "Letters, 1900", "1500", "", "2", "8", "6", "false", "0", "false", ""}
+			if !reflect.DeepEqual(records[1], want) {
+				t.Errorf("expected %v, got %v", want, records[1])
+			}
+			if records[2][11] != "object does not exist in the archive" {
+				t.Errorf("expected the error, got %v", records[2])
+			}
+		}},
+		{format: reportFormatJSON, check: func(t *testing.T, output string) {
+			decoded := collectionReport{}
+			if err := json.Unmarshal([]byte(output), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, report) {
+				t.Errorf("expected %+v, got %+v", report, decoded)
+			}
+		}},
+		{format: reportFormatHTML, check: func(t *testing.T, output string) {
+			for _, want := range []string{"alma:1", "Letters, 1900", "1.5 kB", "object does not exist in the archive"} {
+				if !strings.Contains(output, want) {
+					t.Errorf("expected %q in the page", want)
+				}
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := writeCollectionReport(buf, test.format, report); err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, buf.String())
+		})
+	}
+	if err := writeCollectionReport(&bytes.Buffer{}, "xml", report); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteCollectionReportFile(t *testing.T) {
+	folder := t.TempDir()
+	reportPath := filepath.Join(folder, "report.json")
+	if err := writeCollectionReportFile(reportPath, reportFormatJSON, testCollectionReport()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(data) {
+		t.Errorf("invalid report %s", data)
+	}
+	if err := writeCollectionReportFile(filepath.Join(folder, "missing", "report.json"), reportFormatJSON, testCollectionReport()); err == nil {
+		t.Error("expected an error for a missing folder")
+	}
+}
+
+func TestParseArchiveTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{value: "2026-02-01T10:00:00Z", want: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC), ok: true},
+		{value: "2026-02-01 10:00:00.5+00:00", want: time.Date(2026, 2, 1, 10, 0, 0, 500000000, time.UTC), ok: true},
+		{value: "2026-02-01 10:00:00", want: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC), ok: true},
+		{value: "2026-02-01", want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{value: ""},
+		{value: "yesterday"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			parsed, ok := parseArchiveTime(test.value)
+			if ok != test.ok || !parsed.Equal(test.want) {
+				t.Errorf("expected %v (%v), got %v (%v)", test.want, test.ok, parsed, ok)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 999, want: "999 B"},
+		{size: 1500, want: "1.5 kB"},
+		{size: 2500000000, want: "2.5 GB"},
+	}
+	for _, test := range tests {
+		if formatted := formatBytes(test.size); formatted != test.want {
+			t.Errorf("expected %s for %d, got %s", test.want, test.size, formatted)
+		}
+	}
+}
@@ -4,8 +4,18 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/jwalton/go-supportscolor"
+
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/service"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +29,16 @@ help of different flags you could tune the download process as needed.
 For every command certain environmental variables should be set or path to .yml or .toml file with
 needed variables should be provided after "config" or short "-c"
 
+A configuration file can contain several named profiles, e.g. for test, staging and production.
+The profile is selected with "profile", the environmental variable ONA_PROFILE or the default-profile
+of the file. Profiles with "confirm: true" ask before ingests and bulk operations.
+
+Every configuration value can also be set with an ONA_* environmental variable (e.g. ONA_CHUNK_SIZE,
+ONA_STORAGE_SECRET) or with "set key=value". Flags take precedence over environmental variables,
+which take precedence over the configuration file. "config show --resolved" prints the effective values.
+Secrets can be given as references: file:/run/secrets/jwt, env:NAME, keyring:service/user or
+keepass:/path/db.kdbx#entry (unlocked with ONA_KEEPASS_PASSWORD and/or ONA_KEEPASS_KEYFILE).
+
 Example:
 
 ingest -p C:\Users\zhb_e-manuscripta-2zip -c C:\Users\config.yml`,
@@ -27,13 +47,35 @@ ingest -p C:\Users\zhb_e-manuscripta-2zip -c C:\Users\config.yml`,
 	// Run: func(cmd *cobra.Command, args []string) { },
 }
 
+// exitCode is the exit code of ona after the command returned
+var exitCode int
+
+// markFailed makes ona exit with a non-zero code, after the deferred cleanup of the command ran
+func markFailed() {
+	exitCode = 1
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The context of the commands is cancelled on SIGINT or SIGTERM, a second signal terminates immediately.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "\nCancelling, press Ctrl-C again to terminate immediately")
+			stop()
+		case <-finished:
+		}
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	close(finished)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
+	os.Exit(exitCode)
 }
 
 func init() {
@@ -47,4 +89,72 @@ func init() {
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringP("config", "c", "", "Path to configuration file")
+	rootCmd.PersistentFlags().Bool("insecure", false, "Disable TLS certificate verification (not recommended)")
+	rootCmd.PersistentFlags().String("profile", "", "Profile of the configuration file, ONA_PROFILE or the default profile if empty")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	rootCmd.PersistentFlags().String("progress", progressAuto, "Progress display: auto, bar, json (events on stderr), log or none")
+	rootCmd.PersistentFlags().StringArray("set", nil, "Override a configuration value with key=value, e.g. --set chunk-size=100, can be repeated")
+}
+
+// loadConfig loads the configuration file given with --config and applies the global flags
+func loadConfig(cmd *cobra.Command) (*configuration.Config, error) {
+	configObj, _, err := loadConfigSources(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if configObj.Profile != "" {
+		if configObj.Confirm && supportscolor.Stderr().SupportsColor {
+			fmt.Fprintf(os.Stderr, "Profile: %s%s%s\n", colorRed, configObj.Profile, colorNone)
+		} else {
+			fmt.Fprintf(os.Stderr, "Profile: %s\n", configObj.Profile)
+		}
+	}
+	if configObj.TLS.Insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is disabled, connections to the archive are not protected")
+	}
+	return configObj, nil
+}
+
+// loadConfigSources resolves the configuration from file, ONA_* environment variables and --set
+func loadConfigSources(cmd *cobra.Command) (*configuration.Config, service.ConfigSources, error) {
+	cfgFilePath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, nil, err
+	}
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		return nil, nil, err
+	}
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return nil, nil, err
+	}
+	configObj, sources, err := service.LoadConfig(cfgFilePath, profile, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	if insecure {
+		configObj.TLS.Insecure = true
+		sources["tls.insecure"] = service.SourceFlag
+	}
+	return configObj, sources, nil
+}
+
+// confirm asks before action is executed, if the active profile requires a confirmation
+func confirm(cmd *cobra.Command, configObj *configuration.Config, action string) bool {
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil || yes || !configObj.Confirm {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "You are about to %s on profile %s. Continue? [y/N] ", action, configObj.Profile)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
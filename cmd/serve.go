@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/filesystem/v3/pkg/vfsrw"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/gateway"
+	"github.com/ocfl-archive/ona/pkg/ingest"
+	"github.com/ocfl-archive/ona/pkg/jobs"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/service"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServeAddr = "localhost:8765"
+	shutdownTimeout  = 30 * time.Second
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a local REST API for ingest and copy jobs",
+	Long: `Run a local REST API for ingest and copy jobs. Jobs are stored in a persistent queue, run with bounded
+	concurrency and retried with backoff if they fail. Jobs which are interrupted are resumed after a restart.
+	The dashboard at / shows the jobs with progress and archiving status and can retry or cancel them.
+	The API is described at /api/v1/openapi.yaml. The serve section of the configuration sets the listen
+	address, the job directory, the number of workers, the retries, the retention of finished jobs and the
+	bearer token of the API.
+	serve does not start without a token, unless no-auth is given. Requests are accepted for localhost, the
+	host of the listen address and the host names in serve.hosts.
+	For example:
+	ona serve -c C:\Users\config.yml
+	curl -X POST localhost:8765/api/v1/jobs -H "Authorization: Bearer $TOKEN" -H "Content-Type: application/json" \
+	  -d '{"type":"ingest","params":{"path":"/data/123-345.zip","wait":true}}'
+	curl -H "Authorization: Bearer $TOKEN" localhost:8765/api/v1/jobs/<id>
+	curl -H "Authorization: Bearer $TOKEN" localhost:8765/api/v1/jobs/<id>/log`,
+	Run: serve,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", "", "Listen address, serve.addr or "+defaultServeAddr+" if empty")
+	serveCmd.Flags().Bool("no-auth", false, "Serve the API without serve.token, every local process and web page on an allowed host can submit jobs")
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	addr, err := cmd.Flags().GetString("addr")
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	noAuth, err := cmd.Flags().GetBool("no-auth")
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	configObj, err := loadConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	defer startMetrics(configObj.Metrics, logger)()
+	// the jobs are traced, not the server
+	shutdownTracing, err := setupTracing(cmd.Context(), configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	defer shutdownTracing()
+
+	if addr == "" {
+		addr = configObj.Serve.Addr
+	}
+	if addr == "" {
+		addr = defaultServeAddr
+	}
+	if configObj.Serve.Token == "" && !noAuth {
+		logger.Error().Msgf("serve.token is not set, set a token or start serve with --no-auth")
+		markFailed()
+		return
+	}
+	jobDir, err := serveJobDir(configObj.Serve)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	queue, err := jobs.NewQueue(jobDir, jobs.Options{
+		Workers:   configObj.Serve.Workers,
+		Retries:   configObj.Serve.Retries,
+		RetryWait: time.Duration(configObj.Serve.RetryWait) * time.Second,
+		Retention: time.Duration(configObj.Serve.Retention) * 24 * time.Hour,
+	}, logger)
+	if err != nil {
+		logger.Error().Msgf("cannot open job queue: %v", err)
+		markFailed()
+		return
+	}
+
+	ingester, err := ingest.NewIngester(*configObj, logger)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	vfsConfig, err := service.LoadVfsConfig(*configObj)
+	if err != nil {
+		logger.Error().Msgf("error mapping json for storage location connection field: %v", err)
+		markFailed()
+		return
+	}
+	vfs, err := vfsrw.NewFS(vfsConfig, logger)
+	if err != nil {
+		logger.Error().Msgf("cannot create vfs: %v", err)
+		markFailed()
+		return
+	}
+	defer func() {
+		if err := vfs.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close vfs")
+		}
+	}()
+	queue.Register(gateway.JobIngest, jobs.Handler{
+		Validate: func(params json.RawMessage) error {
+			_, err := gateway.DecodeIngestParams(params)
+			return err
+		},
+		Run: ingestJob(ingester),
+	})
+	queue.Register(gateway.JobCopy, jobs.Handler{
+		Validate: func(params json.RawMessage) error {
+			_, err := gateway.DecodeCopyParams(params)
+			return err
+		},
+		Run: copyJob(ingester.Client(), vfs),
+	})
+
+	metrics.RegisterQueue(queue.Counts)
+
+	if configObj.Serve.Token == "" {
+		logger.Warn().Msgf("serve.token is not set, the API does not require authentication")
+	}
+	hosts := configObj.Serve.Hosts
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" && !net.ParseIP(host).IsUnspecified() {
+		hosts = append(hosts, host)
+	}
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           gateway.NewServer(queue, ingester.Client(), configObj.Serve.Token, hosts, logger).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	queueDone := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(queueDone)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Msgf("cannot shut down server: %v", err)
+		}
+	}()
+	logger.Info().Msgf("serving API on http://%s%s, jobs in %s", addr, gateway.BasePath, jobDir)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error().Msgf("cannot serve API on %s: %v", addr, err)
+		markFailed()
+		cancel()
+	}
+	<-queueDone
+	logger.Info().Msgf("server stopped")
+}
+
+// serveJobDir returns the directory of the job queue, <user config dir>/ona/jobs by default
+func serveJobDir(serveConfig configuration.Serve) (string, error) {
+	if serveConfig.Dir != "" {
+		return serveConfig.Dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot find user config directory")
+	}
+	return filepath.Join(configDir, "ona", "jobs"), nil
+}
+
+// ingestJob runs ingest jobs. If a previous attempt finished the upload, only the archiving status is polled.
+func ingestJob(ingester *ingest.Ingester) func(ctx context.Context, job jobs.Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error) {
+	return func(ctx context.Context, job jobs.Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error) {
+		params, err := gateway.DecodeIngestParams(job.Params)
+		if err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		// the messages of the ingest belong to the log of the job
+		ingester := ingester.WithLogger(logger)
+		previous := ingest.Result{}
+		if len(job.Result) > 0 {
+			if err := json.Unmarshal(job.Result, &previous); err != nil {
+				logger.Warn().Msgf("cannot read result of previous attempt: %v", err)
+			}
+		}
+		if previous.StatusId != "" && previous.Status == ingest.StatusInitialCopying {
+			logger.Info().Msgf("upload of %s was finished before, status %s", params.Path, previous.StatusId)
+			if !params.Wait {
+				return previous, nil
+			}
+			return waitForArchive(ctx, ingester, previous)
+		}
+
+		// the ingest does not wait, so a retry after the upload only polls the status
+		result, err := ingester.Ingest(ctx, ingest.Source{Path: params.Path, MetadataPath: params.Metadata, Checksum: params.Checksum}, ingest.Options{
+			ComputeChecksum: params.ComputeChecksum,
+			Progress:        reporter,
+		})
+		if errors.Is(err, ingest.ErrChecksumMissing) || errors.Is(err, ingest.ErrExists) {
+			return result, jobs.Permanent(err)
+		}
+		if err != nil {
+			return result, err
+		}
+		logger.Info().Msgf("upload of %s finished, status %s", params.Path, result.StatusId)
+		if !params.Wait {
+			return result, nil
+		}
+		return waitForArchive(ctx, ingester, result)
+	}
+}
+
+// waitForArchive polls the archiving status, an upload with status error fails permanently
+func waitForArchive(ctx context.Context, ingester *ingest.Ingester, uploaded ingest.Result) (any, error) {
+	status, err := ingester.WaitForStatus(ctx, uploaded.StatusId, 0)
+	if err != nil {
+		return uploaded, err
+	}
+	result := uploaded
+	result.Status = status
+	if status == ingest.StatusError {
+		return result, jobs.Permanent(errors.Errorf("archiving of %s failed, status %s", result.Signature, result.StatusId))
+	}
+	return result, nil
+}
+
+// copyJob runs copy jobs. Objects which were copied by a previous attempt are verified and skipped.
+func copyJob(client *service.Client, vfs fs.FS) func(ctx context.Context, job jobs.Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error) {
+	return func(ctx context.Context, job jobs.Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error) {
+		params, err := gateway.DecodeCopyParams(job.Params)
+		if err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		signatures, err := collectSignatures(params.Signatures, "", params.Collection, params.Query)
+		if err != nil {
+			return nil, jobs.Permanent(errors.Wrap(err, "cannot collect signatures"))
+		}
+		options := copyOptions{path: params.Path, to: params.To, version: params.Version, extract: params.Extract, metadata: params.Metadata, reporter: reporter}
+		results := make([]copyResult, 0, len(signatures))
+		failed := 0
+		for _, signature := range signatures {
+			result := copyObject(ctx, client, vfs, signature, options, logger)
+			if result.Status == copyStatusError {
+				failed++
+			}
+			results = append(results, result)
+		}
+		if failed > 0 {
+			return results, errors.Errorf("%d of %d objects could not be copied", failed, len(results))
+		}
+		return results, nil
+	}
+}
@@ -24,20 +24,42 @@ func init() {
 }
 
 func getStatus(cmd *cobra.Command, args []string) {
-	cfgFilePath, err := cmd.Flags().GetString("config")
+	configObj, err := loadConfig(cmd)
 	if err != nil {
 		fmt.Println(err)
+		markFailed()
 		return
 	}
-	configObj := service.GetConfig(cfgFilePath)
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	defer endTracing()
 	id, _ := cmd.Flags().GetString("id")
 	if id == "" {
-		fmt.Println("You should should specify id")
+		logger.Error().Msgf("You should should specify id")
+		markFailed()
 		return
 	}
-	status, err := service.GetStatus(id, *configObj)
+	client, err := service.NewClient(*configObj)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error().Msgf("cannot create client: %v", err)
+		markFailed()
+		return
+	}
+	status, err := client.GetStatus(cmd.Context(), id)
+	if err != nil {
+		logger.Error().Msgf("cannot get status %s: %s", id, describeError(err))
+		markFailed()
 		return
 	}
 	fmt.Println(status.Status)
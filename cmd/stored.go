@@ -1,8 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"emperror.dev/errors"
 	"github.com/jwalton/go-supportscolor"
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
 	"github.com/ocfl-archive/ona/service"
 	"github.com/spf13/cobra"
 )
@@ -14,9 +27,13 @@ const colorNone = "\033[0m"
 var generateCmdStored = &cobra.Command{
 	Use:   "stored",
 	Short: "Check whether/how file is stored",
-	Long: `Check whether/how file is stored.
+	Long: `Check whether/how an object is stored. The object is selected by signature, checksum or file name.
+	Every instance is listed with its storage location, path, size, status, creation date and the result of
+	the last fixity check, followed by the quality of the locations and the quality needed by the collection.
+	A file name or checksum can match several objects, each of them is listed.
 	For example:
 	ona stored -n test_file_ub.zip -c C:\Users\config.yml
+	ona stored -s alma:1234/5.6 --json -c C:\Users\config.yml
 	`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
@@ -26,50 +43,381 @@ var generateCmdStored = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(generateCmdStored)
 	generateCmdStored.Flags().StringP("name", "n", "", "name of file to be checked")
+	generateCmdStored.Flags().StringP("signature", "s", "", "signature of object to be checked")
+	generateCmdStored.Flags().String("checksum", "", "sha512 checksum of object to be checked")
+	generateCmdStored.Flags().Bool("json", false, "print the report as json")
+}
+
+// storedObject is the report of ona stored for one object
+type storedObject struct {
+	Signature  string           `json:"signature,omitempty"`
+	ObjectId   string           `json:"object-id"`
+	Collection string           `json:"collection,omitempty"`
+	Checksum   string           `json:"checksum,omitempty"`
+	Size       int64            `json:"size,omitempty"`
+	Head       string           `json:"head,omitempty"`
+	Resulting  int64            `json:"resulting-quality"`
+	Needed     int64            `json:"needed-quality"`
+	Instances  []storedInstance `json:"instances"`
+}
+
+// storedInstance is an object instance with its storage location and its last fixity check
+type storedInstance struct {
+	Id           string                      `json:"id"`
+	Location     string                      `json:"location"`
+	LocationType string                      `json:"location-type,omitempty"`
+	Quality      int64                       `json:"quality"`
+	Path         string                      `json:"path"`
+	Size         int64                       `json:"size"`
+	Status       string                      `json:"status"`
+	Created      string                      `json:"created"`
+	LastCheck    *models.ObjectInstanceCheck `json:"last-check,omitempty"` // nil if unknown
 }
 
 func checkStorage(cmd *cobra.Command, args []string) {
-	cfgFilePath, err := cmd.Flags().GetString("config")
+	configObj, err := loadConfig(cmd)
 	if err != nil {
 		fmt.Println(err)
+		markFailed()
 		return
 	}
-	configObj := service.GetConfig(cfgFilePath)
+	logger, closeLogger, err := newLogger(cmd, configObj)
+	if err != nil {
+		fmt.Println(err)
+		markFailed()
+		return
+	}
+	defer closeLogger()
+	endTracing, err := startTracing(cmd, configObj.Tracing)
+	if err != nil {
+		logger.Error().Msgf("%v", err)
+		markFailed()
+		return
+	}
+	defer endTracing()
 	name, _ := cmd.Flags().GetString("name")
-	if name == "" {
-		fmt.Println("You should should specify name")
+	signature, _ := cmd.Flags().GetString("signature")
+	checksum, _ := cmd.Flags().GetString("checksum")
+	asJson, _ := cmd.Flags().GetBool("json")
+	if name == "" && signature == "" && checksum == "" {
+		logger.Error().Msgf("You should should specify name, signature or checksum")
+		markFailed()
 		return
 	}
-	objectInstances, err := service.GetObjectInstancesByName(name, *configObj)
+	client, err := service.NewClient(*configObj)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error().Msgf("cannot create client: %v", err)
+		markFailed()
 		return
 	}
-	if len(objectInstances.ObjectInstances) == 0 {
-		fmt.Printf("File with name %v is stored on %v storage locations\n", name, len(objectInstances.ObjectInstances))
-	} else {
-		resultingQualityPb, err := service.GetQualityForObject(objectInstances.ObjectInstances[0].ObjectId, service.ResultingQuality, *configObj)
+	objects, err := findStoredObjects(cmd.Context(), client, name, signature, checksum)
+	if err != nil {
+		logger.Error().Msgf("%s", describeError(err))
+		markFailed()
+		return
+	}
+	if asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(objects); err != nil {
+			logger.Error().Msgf("cannot write report: %v", err)
+			markFailed()
+		}
+		return
+	}
+	if len(objects) == 0 {
+		fmt.Println("No object found")
+		return
+	}
+	for index, object := range objects {
+		if index > 0 {
+			fmt.Println()
+		}
+		printStoredObject(os.Stdout, object, supportscolor.Stdout().SupportsColor)
+	}
+}
+
+// findStoredObjects returns the objects with the signature, the checksum or instances with the file name
+func findStoredObjects(ctx context.Context, client *service.Client, name string, signature string, checksum string) ([]storedObject, error) {
+	locations := newStorageLocations(client)
+	var objects []*pb.Object
+	switch {
+	case signature != "":
+		objectPb, err := client.GetObjectBySignature(ctx, signature)
+		if err != nil && !errors.Is(err, service.ErrNotFound) {
+			return nil, errors.Wrapf(err, "cannot get object %s", signature)
+		}
+		if objectPb.Id != "" {
+			objects = append(objects, objectPb)
+		}
+	case checksum != "":
+		objectsPb, err := client.GetObjectsByChecksum(ctx, checksum)
+		if err != nil && !errors.Is(err, service.ErrNotFound) {
+			return nil, errors.Wrapf(err, "cannot get objects with checksum %s", checksum)
+		}
+		objects = objectsPb.Objects
+	default:
+		return findStoredObjectsByName(ctx, client, name, locations)
+	}
+	result := make([]storedObject, 0, len(objects))
+	for _, objectPb := range objects {
+		object, err := storedObjectOf(ctx, client, objectPb, locations)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, err
+		}
+		result = append(result, object)
+	}
+	return result, nil
+}
+
+// storedObjectOf returns the report of an object of the archive. The manager lists the instances of all
+// locations only by file name. The instance on the storage of the configuration is looked up by signature, as
+// copy does, the instances of all locations by the name ingest stores the object under and by the name of that
+// instance, which differs for objects ingested before the encoding of signatures. They are filtered by object id.
+func storedObjectOf(ctx context.Context, client *service.Client, objectPb *pb.Object, locations *storageLocations) (storedObject, error) {
+	names := []string{service.SignatureFileName(objectPb.Signature, ".zip")}
+	var own []*pb.ObjectInstance
+	known := map[string]bool{}
+	instance, err := client.GetObjectInstancesBySignatureAndLocationsPathName(ctx, objectPb.Signature)
+	switch {
+	case err == nil && instance.Id != "":
+		own = append(own, instance)
+		known[instance.Id] = true
+		if name := path.Base(instance.Path); name != names[0] {
+			names = append(names, name)
 		}
-		neededQualityPb, err := service.GetQualityForObject(objectInstances.ObjectInstances[0].ObjectId, service.NeededQuality, *configObj)
+	case err != nil && !errors.Is(err, service.ErrNotFound):
+		return storedObject{}, errors.Wrapf(err, "cannot get object instance of %s", objectPb.Signature)
+	}
+	for _, name := range names {
+		instances, err := objectInstances(ctx, client, name)
 		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		resultingQuality := resultingQualityPb.Size
-		qualityNeeded := neededQualityPb.Size
-		color := ""
-		if resultingQualityPb.Size >= qualityNeeded {
-			color = colorGreen
-		} else {
-			color = colorRed
+			return storedObject{}, err
+		}
+		for _, instance := range instances {
+			if instance.ObjectId == objectPb.Id && !known[instance.Id] {
+				own = append(own, instance)
+				known[instance.Id] = true
+			}
+		}
+	}
+	return newStoredObject(ctx, client, objectPb.Id, objectPb, own, locations)
+}
+
+// findStoredObjectsByName groups the instances with the file name by object. The object metadata is known
+// for the object with the signature of the file name, a name from before the encoding is decoded as well.
+func findStoredObjectsByName(ctx context.Context, client *service.Client, name string, locations *storageLocations) ([]storedObject, error) {
+	instances, err := objectInstances(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+	var objectIds []string
+	byObject := map[string][]*pb.ObjectInstance{}
+	for _, instance := range instances {
+		if _, ok := byObject[instance.ObjectId]; !ok {
+			objectIds = append(objectIds, instance.ObjectId)
+		}
+		byObject[instance.ObjectId] = append(byObject[instance.ObjectId], instance)
+	}
+	var objectPb *pb.Object
+	if len(objectIds) > 0 {
+		for _, signature := range fileNameSignatures(name) {
+			candidate, err := client.GetObjectBySignature(ctx, signature)
+			if errors.Is(err, service.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot get object %s", signature)
+			}
+			if _, ok := byObject[candidate.Id]; ok {
+				objectPb = candidate
+				break
+			}
+		}
+	}
+	result := make([]storedObject, 0, len(objectIds))
+	for _, objectId := range objectIds {
+		var metadata *pb.Object
+		if objectPb != nil && objectPb.Id == objectId {
+			metadata = objectPb
+		}
+		object, err := newStoredObject(ctx, client, objectId, metadata, byObject[objectId], locations)
+		if err != nil {
+			return nil, err
 		}
-		if !supportscolor.Stdout().SupportsColor {
-			fmt.Printf("File with name %v is stored on %v storage locations with quality %v. The lowest quality needed: %v\n", name, len(objectInstances.ObjectInstances), resultingQuality, qualityNeeded)
+		result = append(result, object)
+	}
+	return result, nil
+}
+
+// fileNameSignatures returns the signatures a file name can stand for: the decoded signature and the name
+// from before the encoding
+func fileNameSignatures(fileName string) []string {
+	var signatures []string
+	if signature, err := service.SignatureFromFileName(fileName); err == nil {
+		signatures = append(signatures, signature)
+	}
+	if signature, err := service.SignatureFromLegacyFileName(fileName); err == nil && !slices.Contains(signatures, signature) {
+		signatures = append(signatures, signature)
+	}
+	return signatures
+}
+
+// objectInstances returns the instances with the file name, the manager answers not found or an empty list
+// if there are none
+func objectInstances(ctx context.Context, client *service.Client, name string) ([]*pb.ObjectInstance, error) {
+	instances, err := client.GetObjectInstancesByName(ctx, name)
+	if errors.Is(err, service.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get object instances of %s", name)
+	}
+	return instances.ObjectInstances, nil
+}
+
+// storageLocations caches the storage locations by partition id, it is safe for concurrent use
+type storageLocations struct {
+	sync.Mutex
+	client      *service.Client
+	byPartition map[string]models.StorageLocation
+}
+
+func newStorageLocations(client *service.Client) *storageLocations {
+	return &storageLocations{client: client, byPartition: map[string]models.StorageLocation{}}
+}
+
+// get returns the storage location of the partition. If the manager does not know it or has no route for it,
+// the partition id is used as alias.
+func (l *storageLocations) get(ctx context.Context, partitionId string) (models.StorageLocation, error) {
+	l.Lock()
+	defer l.Unlock()
+	if location, ok := l.byPartition[partitionId]; ok {
+		return location, nil
+	}
+	location, err := l.client.GetStorageLocationByPartitionId(ctx, partitionId)
+	if isOptionalMissing(err) {
+		location, err = models.StorageLocation{Alias: "partition " + partitionId}, nil
+	}
+	if err != nil {
+		return location, errors.Wrapf(err, "cannot get storage location of partition %s", partitionId)
+	}
+	l.byPartition[partitionId] = location
+	return location, nil
+}
+
+// newStoredObject completes the instances with storage location and last fixity check and adds the qualities.
+// objectPb may be nil, if the metadata is not known.
+func newStoredObject(ctx context.Context, client *service.Client, objectId string, objectPb *pb.Object, instances []*pb.ObjectInstance, locations *storageLocations) (storedObject, error) {
+	object := storedObject{ObjectId: objectId, Instances: []storedInstance{}}
+	if objectPb != nil {
+		object.Signature = objectPb.Signature
+		object.Collection = objectPb.Collection
+		object.Checksum = objectPb.Checksum
+		object.Size = objectPb.Size
+		object.Head = objectPb.Head
+	}
+	for _, instance := range instances {
+		location, err := locations.get(ctx, instance.StoragePartitionId)
+		if err != nil {
+			return object, err
+		}
+		stored := storedInstance{
+			Id:           instance.Id,
+			Location:     location.Alias,
+			LocationType: location.Type,
+			Quality:      location.Quality,
+			Path:         instance.Path,
+			Size:         instance.Size,
+			Status:       instance.Status,
+			Created:      instance.Created,
+		}
+		check, err := client.GetLastObjectInstanceCheck(ctx, instance.Id)
+		switch {
+		case err == nil:
+			stored.LastCheck = &check
+		case !isOptionalMissing(err):
+			return object, errors.Wrapf(err, "cannot get last check of object instance %s", instance.Id)
+		}
+		object.Instances = append(object.Instances, stored)
+	}
+	if len(instances) == 0 {
+		return object, nil
+	}
+	resulting, err := client.GetQualityForObject(ctx, objectId, service.ResultingQuality)
+	if err != nil {
+		return object, errors.Wrapf(err, "cannot get resulting quality of object %s", objectId)
+	}
+	needed, err := client.GetQualityForObject(ctx, objectId, service.NeededQuality)
+	if err != nil {
+		return object, errors.Wrapf(err, "cannot get needed quality of object %s", objectId)
+	}
+	object.Resulting = resulting.Size
+	object.Needed = needed.Size
+	return object, nil
+}
+
+// locationCount returns the number of storage locations with an instance of the object
+func (o storedObject) locationCount() int {
+	locations := map[string]bool{}
+	for _, instance := range o.Instances {
+		locations[instance.Location] = true
+	}
+	return len(locations)
+}
+
+// printStoredObject writes the report of object as a table of its instances
+func printStoredObject(w io.Writer, object storedObject, color bool) {
+	if object.Signature != "" {
+		fmt.Fprintf(w, "Object %s (id %s), collection %s, size %d, head %s\n", object.Signature, object.ObjectId, object.Collection, object.Size, object.Head)
+		fmt.Fprintf(w, "Checksum %s\n", object.Checksum)
+	} else {
+		fmt.Fprintf(w, "Object with id %s\n", object.ObjectId)
+	}
+	if len(object.Instances) == 0 {
+		fmt.Fprintln(w, "The object is not stored on any storage location")
+		return
+	}
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "LOCATION\tTYPE\tQUALITY\tSTATUS\tSIZE\tCREATED\tLAST CHECK\tPATH")
+	// quality per location, several instances on one location count once
+	var contributions []string
+	counted := map[string]bool{}
+	for _, instance := range object.Instances {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n", instance.Location, instance.LocationType, instance.Quality,
+			instance.Status, instance.Size, instance.Created, describeCheck(instance.LastCheck), instance.Path)
+		if !counted[instance.Location] {
+			counted[instance.Location] = true
+			contributions = append(contributions, fmt.Sprintf("%s %d", instance.Location, instance.Quality))
+		}
+	}
+	writer.Flush()
+	quality := fmt.Sprintf("%d", object.Resulting)
+	if color {
+		if object.Resulting >= object.Needed {
+			quality = colorGreen + quality + colorNone
 		} else {
-			fmt.Printf("File with name %v is stored on %v storage locations %v with quality %v%v. The lowest quality needed: %v\n", name, len(objectInstances.ObjectInstances), color, resultingQuality, colorNone, qualityNeeded)
+			quality = colorRed + quality + colorNone
 		}
 	}
+	fmt.Fprintf(w, "Stored on %d storage locations with quality %s (%s). The lowest quality needed: %d\n",
+		object.locationCount(), quality, strings.Join(contributions, " + "), object.Needed)
+}
+
+// isOptionalMissing reports whether the manager cannot answer a lookup of an optional route, because the entry
+// or the route does not exist
+func isOptionalMissing(err error) bool {
+	return errors.Is(err, service.ErrNotFound) || errors.Is(err, service.ErrNotSupported)
+}
+
+// describeCheck summarizes a fixity check for the table
+func describeCheck(check *models.ObjectInstanceCheck) string {
+	switch {
+	case check == nil:
+		return "unknown"
+	case check.Error:
+		return fmt.Sprintf("error %s: %s", check.Checktime, check.Message)
+	default:
+		return "ok " + check.Checktime
+	}
 }
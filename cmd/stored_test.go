@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+)
+
+// newStoredTestManager returns a manager with the object alma:1 on disk and tape and an instance of another
+// object with the same file name
+func newStoredTestManager() *testManager {
+	objectPb := &pb.Object{Id: "1", Signature: "alma:1", Collection: "test", Size: 1, Checksum: sha512Hex("a"), Head: "v1"}
+	return &testManager{
+		objects: map[string]*pb.Object{"alma:1": objectPb},
+		instances: map[string]*pb.ObjectInstance{
+			"alma:1": {Id: "i1", ObjectId: "1", Path: "storage/alma+1.zip", StoragePartitionId: "p1"},
+		},
+		named: map[string][]*pb.ObjectInstance{
+			"alma+1.zip": {
+				{Id: "i1", ObjectId: "1", Path: "storage/alma+1.zip", StoragePartitionId: "p1"},
+				{Id: "i2", ObjectId: "1", Path: "tape/alma+1.zip", StoragePartitionId: "p2"},
+				{Id: "i3", ObjectId: "2", Path: "tape/other/alma+1.zip", StoragePartitionId: "p2"},
+			},
+		},
+		checksums: map[string][]*pb.Object{sha512Hex("a"): {objectPb}},
+		resulting: map[string]int64{"1": 8, "2": 4},
+		needed:    map[string]int64{"1": 6, "2": 6},
+		locations: map[string]models.StorageLocation{
+			"p1": {Id: "l1", Alias: "disk", Type: "s3", Quality: 4},
+			"p2": {Id: "l2", Alias: "tape", Type: "tape", Quality: 4},
+		},
+		lastChecks: map[string]models.ObjectInstanceCheck{
+			"i2": {Id: "c1", Checktime: "2026-01-01", ObjectInstanceId: "i2"},
+		},
+	}
+}
+
+func TestFindStoredObjects(t *testing.T) {
+	// optional routes the manager has not
+	withoutRoutes := func(absent int) func(manager *testManager) {
+		return func(manager *testManager) {
+			manager.locations = nil
+			manager.lastChecks = nil
+			manager.absent = absent
+		}
+	}
+	tests := []struct {
+		name      string
+		modify    func(manager *testManager)
+		signature string
+		checksum  string
+		fileName  string
+		objects   []string
+		locations []string
+		checks    []bool
+		wantErr   bool
+	}{
+		{name: "signature", signature: "alma:1", objects: []string{"1"}, locations: []string{"disk", "tape"}, checks: []bool{false, true}},
+		{name: "checksum", checksum: sha512Hex("a"), objects: []string{"1"}, locations: []string{"disk", "tape"}, checks: []bool{false, true}},
+		{name: "file name", fileName: "alma+1.zip", objects: []string{"1", "2"}, locations: []string{"disk", "tape"}, checks: []bool{false, true}},
+		{name: "unknown signature", signature: "alma:2"},
+		{name: "unknown checksum", checksum: sha512Hex("b")},
+		{name: "unknown file name", fileName: "alma+2.zip"},
+		{name: "routes not found", modify: withoutRoutes(0), signature: "alma:1", objects: []string{"1"},
+			locations: []string{"partition p1", "partition p2"}, checks: []bool{false, false}},
+		{name: "routes not implemented", modify: withoutRoutes(http.StatusNotImplemented), signature: "alma:1", objects: []string{"1"},
+			locations: []string{"partition p1", "partition p2"}, checks: []bool{false, false}},
+		{name: "routes method not allowed", modify: withoutRoutes(http.StatusMethodNotAllowed), signature: "alma:1", objects: []string{"1"},
+			locations: []string{"partition p1", "partition p2"}, checks: []bool{false, false}},
+		{name: "routes failing", modify: withoutRoutes(http.StatusInternalServerError), signature: "alma:1", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := newStoredTestManager()
+			if test.modify != nil {
+				test.modify(manager)
+			}
+			client := newTestClient(t, manager)
+			objects, err := findStoredObjects(context.Background(), client, test.fileName, test.signature, test.checksum)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var objectIds []string
+			for _, object := range objects {
+				objectIds = append(objectIds, object.ObjectId)
+			}
+			if !reflect.DeepEqual(objectIds, test.objects) {
+				t.Fatalf("expected objects %v, got %v", test.objects, objectIds)
+			}
+			if len(objects) == 0 {
+				return
+			}
+			object := objects[0]
+			if object.Signature != "alma:1" || object.Head != "v1" || object.Resulting != 8 || object.Needed != 6 {
+				t.Errorf("unexpected object %+v", object)
+			}
+			var locations []string
+			var checks []bool
+			for _, instance := range object.Instances {
+				locations = append(locations, instance.Location)
+				checks = append(checks, instance.LastCheck != nil)
+			}
+			if !reflect.DeepEqual(locations, test.locations) || !reflect.DeepEqual(checks, test.checks) {
+				t.Errorf("expected locations %v with checks %v, got %v with %v", test.locations, test.checks, locations, checks)
+			}
+			// the metadata of an object with another signature is not known
+			if len(objects) > 1 && (objects[1].Signature != "" || len(objects[1].Instances) != 1) {
+				t.Errorf("unexpected object %+v", objects[1])
+			}
+		})
+	}
+}
+
+func TestPrintStoredObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		object storedObject
+		want   []string
+	}{
+		{
+			name: "instances",
+			object: storedObject{Signature: "alma:1", ObjectId: "1", Resulting: 8, Needed: 6, Instances: []storedInstance{
+				{Id: "i1", Location: "disk", Quality: 4, Path: "storage/alma+1.zip"},
+				{Id: "i2", Location: "tape", Quality: 4, Path: "tape/alma+1.zip",
+					LastCheck: &models.ObjectInstanceCheck{Checktime: "2026-01-01", Error: true, Message: "checksum mismatch"}},
+				{Id: "i3", Location: "tape", Quality: 4, Path: "tape/copy/alma+1.zip", LastCheck: &models.ObjectInstanceCheck{Checktime: "2026-02-01"}},
+			}},
+			want: []string{"Object alma:1 (id 1)", "unknown", "error 2026-01-01: checksum mismatch", "ok 2026-02-01",
+				"Stored on 2 storage locations with quality 8 (disk 4 + tape 4). The lowest quality needed: 6"},
+		},
+		{
+			name:   "without metadata",
+			object: storedObject{ObjectId: "2"},
+			want:   []string{"Object with id 2", "The object is not stored on any storage location"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			printStoredObject(buf, test.object, false)
+			for _, want := range test.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected %q in\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
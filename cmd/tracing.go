@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const tracingShutdownTimeout = 10 * time.Second
+
+// setupTracing installs the exporter of the tracing section. The returned function exports the remaining spans,
+// it has to be called when the command ends.
+func setupTracing(ctx context.Context, tracingConfig configuration.Tracing) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, tracing.Options{Exporter: tracingConfig.Exporter, Endpoint: tracingConfig.Endpoint, File: tracingConfig.File})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot export traces: %v\n", err)
+		}
+	}, nil
+}
+
+// startTracing installs the exporter and starts the trace of cmd, the context of cmd carries its root span.
+// The returned function ends the trace and exports the spans.
+func startTracing(cmd *cobra.Command, tracingConfig configuration.Tracing) (func(), error) {
+	shutdown, err := setupTracing(cmd.Context(), tracingConfig)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(cmd.Context(), cmd.CommandPath(), attribute.String("ona.correlation_id", correlation.Id(cmd.Context())))
+	cmd.SetContext(ctx)
+	return func() {
+		span.End()
+		shutdown()
+	}, nil
+}
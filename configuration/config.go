@@ -3,24 +3,102 @@ package configuration
 import "github.com/je4/utils/v2/pkg/stashconfig"
 
 type Config struct {
+	Profile   string             `yaml:"-" toml:"-"`             // name of the active profile, empty without profiles
+	Confirm   bool               `yaml:"confirm" toml:"Confirm"` // ask before ingests and bulk operations, e.g. for production
 	Url       string             `yaml:"url" toml:"Url"`
-	Key       string             `yaml:"key" toml:"Key"`
+	Key       string             `yaml:"key" toml:"Key" secret:"true"`
 	ChunkSize int64              `yaml:"chunk-size" toml:"ChunkSize"`
 	BarPause  int                `yaml:"bar-pause" toml:"BarPause"`
 	StatusUrl string             `yaml:"status-url" toml:"StatusUrl"`
-	JwtKey    string             `yaml:"jwt-key" toml:"JwtKey"`
+	JwtKey    string             `yaml:"jwt-key" toml:"JwtKey" secret:"true"`
+	Timeout   int                `yaml:"timeout" toml:"Timeout"`      // seconds per request to the manager
+	Retries   int                `yaml:"retries" toml:"Retries"`      // retries of failed GET requests, -1 disables them
+	RetryWait int                `yaml:"retry-wait" toml:"RetryWait"` // milliseconds before the first retry, doubled for every further retry
+	Auth      Auth               `yaml:"auth" toml:"Auth"`
+	OIDC      OIDC               `yaml:"oidc" toml:"OIDC"`
+	TLS       TLS                `yaml:"tls" toml:"TLS"`
 	Storage   Storage            `yaml:"storage" toml:"storage"`
+	Targets   []Storage          `yaml:"targets" toml:"targets"`
+	Serve     Serve              `yaml:"serve" toml:"serve"`
+	Metrics   Metrics            `yaml:"metrics" toml:"metrics"`
+	Tracing   Tracing            `yaml:"tracing" toml:"tracing"`
 	Log       stashconfig.Config `yaml:"log" toml:"Log"`
 }
 
+// Profiles is a configuration file with named configurations for several archive environments
+type Profiles struct {
+	DefaultProfile string            `yaml:"default-profile" toml:"DefaultProfile"`
+	Profiles       map[string]Config `yaml:"profiles" toml:"Profiles"`
+}
+
+// Auth configures the tokens sent to the manager. Without PrivateKey the tokens are signed with JwtKey (HS256).
+type Auth struct {
+	Algorithm        string   `yaml:"algorithm" toml:"algorithm"`                              // RS256, ES256, EdDSA, ... HS256 if empty
+	PrivateKey       string   `yaml:"private-key" toml:"privatekey"`                           // PEM file or PKCS#12 keystore (.p12, .pfx)
+	KeystorePassword string   `yaml:"keystore-password" toml:"keystorepassword" secret:"true"` // password of the PKCS#12 keystore
+	Issuer           string   `yaml:"issuer" toml:"issuer"`
+	Subject          string   `yaml:"subject" toml:"subject"` // operator, name of the current user if empty
+	Audience         []string `yaml:"audience" toml:"audience"`
+	KeyId            string   `yaml:"key-id" toml:"keyid"`
+	TokenTTL         int      `yaml:"token-ttl" toml:"tokenttl"` // seconds a token is valid, 300 if 0
+}
+
+// OIDC configures ona login. If Issuer is set, the cached tokens are used for the manager and the TUS server.
+type OIDC struct {
+	Issuer          string   `yaml:"issuer" toml:"issuer"`
+	ClientId        string   `yaml:"client-id" toml:"clientid"`
+	ClientSecret    string   `yaml:"client-secret" toml:"clientsecret" secret:"true"`
+	Scopes          []string `yaml:"scopes" toml:"scopes"`
+	Flow            string   `yaml:"flow" toml:"flow"`                        // device (default) or client-credentials
+	CredentialsFile string   `yaml:"credentials-file" toml:"credentialsfile"` // <user config dir>/ona/credentials.json if empty
+}
+
+// TLS configures the connections to the manager and the TUS server
+type TLS struct {
+	CA       []string `yaml:"ca" toml:"ca"`             // PEM files with trusted CA certificates, system trust store if empty
+	Cert     string   `yaml:"cert" toml:"cert"`         // PEM client certificate for mutual TLS
+	Key      string   `yaml:"key" toml:"key"`           // PEM private key of the client certificate
+	Pins     []string `yaml:"pins" toml:"pins"`         // base64 encoded sha256 digests of pinned public keys (SPKI)
+	Insecure bool     `yaml:"insecure" toml:"insecure"` // disables certificate verification
+}
+
+// Serve configures the REST gateway of ona serve
+type Serve struct {
+	Addr      string   `yaml:"addr" toml:"addr"`                 // listen address, localhost:8765 if empty
+	Dir       string   `yaml:"dir" toml:"dir"`                   // directory of the job queue, <user config dir>/ona/jobs if empty
+	Workers   int      `yaml:"workers" toml:"workers"`           // jobs running in parallel, 2 if 0
+	Retries   int      `yaml:"retries" toml:"retries"`           // retries of a failed job, 3 if 0, -1 disables them
+	RetryWait int      `yaml:"retry-wait" toml:"retrywait"`      // seconds before the first retry, doubled for every further retry, 60 if 0
+	Token     string   `yaml:"token" toml:"token" secret:"true"` // bearer token required by the API, serve does not start without it unless --no-auth is given
+	Hosts     []string `yaml:"hosts" toml:"hosts"`               // host names of the API besides localhost and the host of addr
+	Retention int      `yaml:"retention" toml:"retention"`       // days finished jobs and their logs are kept, 30 if 0, -1 keeps them
+}
+
+// Metrics configures the Prometheus metrics of ingest, copy and serve
+type Metrics struct {
+	Addr     string `yaml:"addr" toml:"addr"`         // listen address of /metrics, e.g. localhost:9464, disabled if empty
+	Textfile string `yaml:"textfile" toml:"textfile"` // file for the textfile collector of the node exporter, written when the command ends
+}
+
+// Tracing configures the OpenTelemetry traces of the commands
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"` // otlp, stdout (written to stderr) or file, disabled if empty
+	Endpoint string `yaml:"endpoint" toml:"endpoint"` // OTLP/HTTP collector, e.g. http://localhost:4318, OTEL_EXPORTER_OTLP_ENDPOINT if empty
+	File     string `yaml:"file" toml:"file"`         // json lines file of the file exporter, appended to
+}
+
 type Storage struct {
-	Type         string `yaml:"type" toml:"type"`
-	Name         string `yaml:"name" toml:"name"`
-	Key          string `yaml:"key" toml:"key"`
-	Secret       string `yaml:"secret" toml:"secret"`
-	ApiUrlValue  string `yaml:"api-url-value" toml:"apiurlvalue"`
-	UploadFolder string `yaml:"upload-folder" toml:"uploadfolder"`
-	Url          string `yaml:"url" toml:"url"`
-	CAPEM        string `yaml:"capem" toml:"capem"`
-	Debug        bool   `yaml:"debug" toml:"debug"`
+	Type         string   `yaml:"type" toml:"type"`
+	Name         string   `yaml:"name" toml:"name"`
+	Key          string   `yaml:"key" toml:"key"`
+	Secret       string   `yaml:"secret" toml:"secret" secret:"true"`
+	ApiUrlValue  string   `yaml:"api-url-value" toml:"apiurlvalue"`
+	UploadFolder string   `yaml:"upload-folder" toml:"uploadfolder"`
+	Url          string   `yaml:"url" toml:"url"`
+	CAPEM        string   `yaml:"capem" toml:"capem"`
+	Debug        bool     `yaml:"debug" toml:"debug"`
+	User         string   `yaml:"user" toml:"user"`
+	PrivateKey   []string `yaml:"private-key" toml:"privatekey"`
+	KnownHosts   []string `yaml:"known-hosts" toml:"knownhosts"`
+	BaseDir      string   `yaml:"base-dir" toml:"basedir"`
 }
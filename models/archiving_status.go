@@ -4,4 +4,6 @@ type ArchivingStatus struct {
 	Id          string `json:"id"`
 	Status      string `json:"status"`
 	LastChanged string `json:"lastChanged"`
+	// CorrelationId is the run of ona which created or changed the status
+	CorrelationId string `json:"correlationId,omitempty"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// ObjectInstanceCheck is the result of a fixity check of an object instance
+type ObjectInstanceCheck struct {
+	Id               string `json:"id"`
+	Checktime        string `json:"checktime"`
+	Error            bool   `json:"error"`
+	Message          string `json:"message"`
+	ObjectInstanceId string `json:"objectInstanceId"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// StorageLocation is a storage of the archive, the quality of all locations holding an instance of an object
+// is the resulting quality of the object
+type StorageLocation struct {
+	Id      string `json:"id"`
+	Alias   string `json:"alias"`
+	Type    string `json:"type"`
+	Vault   string `json:"vault"`
+	Quality int64  `json:"quality"`
+}
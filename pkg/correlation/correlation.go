@@ -0,0 +1,32 @@
+// Package correlation ties the log lines of a run of ona to the requests it sends. Every command and every
+// job attempt gets a new id, which is stored in the context, logged and sent in the X-Correlation-Id header.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+// Header carries the correlation id in requests to the manager and the TUS server
+const Header = "X-Correlation-Id"
+
+// LogField is the name of the correlation id in log lines
+const LogField = "correlation-id"
+
+type contextKey struct{}
+
+// NewId returns a random correlation id
+func NewId() string {
+	return rand.Text()
+}
+
+// WithId returns a copy of ctx carrying id
+func WithId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// Id returns the correlation id of ctx, empty if there is none
+func Id(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,255 @@
+// Package gateway is the REST API and the web dashboard of ona serve. Jobs are submitted to a jobs.Queue, the API
+// is described in openapi.yaml, which is served at /api/v1/openapi.yaml. The dashboard is served at /.
+package gateway
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/pkg/ingest"
+	"github.com/ocfl-archive/ona/pkg/jobs"
+	"github.com/ocfl-archive/ona/service"
+)
+
+// BasePath is the prefix of all API routes
+const BasePath = "/api/v1"
+
+const maxRequestSize = 1 << 20
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// submitRequest is the body of POST /jobs
+type submitRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// loopbackHosts are always accepted in the Host header
+var loopbackHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// Server handles the API requests
+type Server struct {
+	queue  *jobs.Queue
+	client *service.Client
+	token  string
+	hosts  map[string]bool
+	logger zLogger.ZLogger
+}
+
+// NewServer creates the API for the queue, client is used for the archiving status of ingests. If token is not
+// empty, API requests need the header "Authorization: Bearer <token>". Requests are only accepted for
+// localhost and the given host names, so web pages cannot reach the API by DNS rebinding.
+func NewServer(queue *jobs.Queue, client *service.Client, token string, hosts []string, logger zLogger.ZLogger) *Server {
+	s := &Server{queue: queue, client: client, token: token, hosts: map[string]bool{}, logger: logger}
+	for _, host := range append(loopbackHosts, hosts...) {
+		s.hosts[strings.ToLower(strings.Trim(host, "[]"))] = true
+	}
+	return s
+}
+
+// Handler returns the routes of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.dashboard)
+	mux.HandleFunc("GET "+BasePath+"/openapi.yaml", s.openAPI)
+	mux.HandleFunc("GET "+BasePath+"/jobs", s.authorized(s.listJobs))
+	mux.HandleFunc("POST "+BasePath+"/jobs", s.authorized(s.submitJob))
+	mux.HandleFunc("GET "+BasePath+"/jobs/{id}", s.authorized(s.getJob))
+	mux.HandleFunc("DELETE "+BasePath+"/jobs/{id}", s.authorized(s.cancelJob))
+	mux.HandleFunc("GET "+BasePath+"/jobs/{id}/log", s.authorized(s.getLog))
+	mux.HandleFunc("POST "+BasePath+"/jobs/{id}/retry", s.authorized(s.retryJob))
+	mux.HandleFunc("GET "+BasePath+"/jobs/{id}/archiving-status", s.authorized(s.getArchivingStatus))
+	return s.sameOrigin(mux)
+}
+
+// sameOrigin rejects requests for unknown hosts and requests of web pages from other origins
+func (s *Server) sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if !s.hosts[strings.ToLower(strings.Trim(host, "[]"))] {
+			s.writeError(w, http.StatusForbidden, errors.Errorf("host '%s' is not allowed, add it to serve.hosts", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			originURL, err := url.Parse(origin)
+			if err != nil || !strings.EqualFold(originURL.Host, r.Host) {
+				s.writeError(w, http.StatusForbidden, errors.Errorf("origin '%s' is not allowed", origin))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				s.writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// dashboard needs no token, the page asks for it when the API rejects a request
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.queue.List(r.URL.Query().Get("status")))
+}
+
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		s.writeError(w, http.StatusUnsupportedMediaType, errors.New("request body must be application/json"))
+		return
+	}
+	request := submitRequest{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	if err := decoder.Decode(&request); err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.Wrap(err, "cannot decode request"))
+		return
+	}
+	if len(request.Params) == 0 {
+		request.Params = json.RawMessage("{}")
+	}
+	job, err := s.queue.Submit(request.Type, request.Params)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", BasePath+"/jobs/"+job.Id)
+	s.writeJSON(w, http.StatusCreated, job)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, jobs.ErrFinished):
+		s.writeError(w, http.StatusConflict, err)
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err)
+	default:
+		s.writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (s *Server) retryJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Retry(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, jobs.ErrNotFinished):
+		s.writeError(w, http.StatusConflict, err)
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err)
+	default:
+		s.writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// getArchivingStatus returns the status of an uploaded ingest from the manager
+func (s *Server) getArchivingStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	result := ingest.Result{}
+	if job.Type == JobIngest && len(job.Result) > 0 {
+		if err := json.Unmarshal(job.Result, &result); err != nil {
+			s.writeError(w, http.StatusInternalServerError, errors.Wrap(err, "cannot read result"))
+			return
+		}
+	}
+	if result.StatusId == "" {
+		s.writeError(w, http.StatusNotFound, errors.Errorf("job %s has no archiving status", job.Id))
+		return
+	}
+	archivingStatus, err := s.client.GetStatus(r.Context(), result.StatusId)
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, errors.Wrapf(err, "cannot get archiving status %s", result.StatusId))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, archivingStatus)
+}
+
+// getLog returns the log of the job as newline-delimited json
+func (s *Server) getLog(w http.ResponseWriter, r *http.Request) {
+	logPath, err := s.queue.LogPath(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	logFile, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the job did not start yet
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, errors.Wrap(err, "cannot open log"))
+		return
+	}
+	defer logFile.Close()
+	if _, err := io.Copy(w, logFile); err != nil {
+		s.logger.Error().Msgf("cannot send log '%s': %v", logPath, err)
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error().Msgf("cannot write response: %v", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		s.logger.Error().Msgf("%v", err)
+	}
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// job types of the API
+const (
+	JobIngest = "ingest"
+	JobCopy   = "copy"
+)
+
+// IngestParams are the parameters of an ingest job, see ona ingest
+type IngestParams struct {
+	Path            string `json:"path"`                       // OCFL zip file on the server
+	Metadata        string `json:"metadata,omitempty"`         // json file with metadata
+	Checksum        string `json:"checksum,omitempty"`         // sha512 of the zip file, read from <path>.sha512 if empty
+	ComputeChecksum bool   `json:"compute-checksum,omitempty"` // compute the checksum instead of reading it
+	Wait            bool   `json:"wait,omitempty"`             // the job ends when the object is archived
+}
+
+// CopyParams are the parameters of a copy job, see ona copy
+type CopyParams struct {
+	Signatures []string `json:"signatures,omitempty"`
+	Collection string   `json:"collection,omitempty"` // alias of a collection, not supported by the DLZA manager
+	Query      string   `json:"query,omitempty"`      // not supported by the DLZA manager
+	Path       string   `json:"path,omitempty"`       // folder on the server
+	To         string   `json:"to,omitempty"`         // vfs://<target>/<folder> instead of path
+	Version    string   `json:"version,omitempty"`
+	Extract    bool     `json:"extract,omitempty"`
+	Metadata   bool     `json:"metadata,omitempty"`
+}
+
+// DecodeIngestParams decodes and checks the parameters of an ingest job
+func DecodeIngestParams(data json.RawMessage) (IngestParams, error) {
+	params := IngestParams{}
+	if err := decodeStrict(data, &params); err != nil {
+		return params, err
+	}
+	if !filepath.IsAbs(params.Path) {
+		return params, errors.New("path should be an absolute path")
+	}
+	if params.Metadata != "" && !filepath.IsAbs(params.Metadata) {
+		return params, errors.New("metadata should be an absolute path")
+	}
+	return params, nil
+}
+
+// DecodeCopyParams decodes and checks the parameters of a copy job
+func DecodeCopyParams(data json.RawMessage) (CopyParams, error) {
+	params := CopyParams{}
+	if err := decodeStrict(data, &params); err != nil {
+		return params, err
+	}
+	if len(params.Signatures) == 0 && params.Collection == "" && params.Query == "" {
+		return params, errors.New("signatures, collection or query should be given")
+	}
+	switch {
+	case params.To != "" && params.Path != "":
+		return params, errors.New("either path or to should be given")
+	case params.To != "" && !strings.HasPrefix(params.To, "vfs://"):
+		return params, errors.New("to should start with vfs://")
+	case params.To == "" && !filepath.IsAbs(params.Path):
+		return params, errors.New("path should be an absolute path")
+	case params.To != "" && params.Extract:
+		return params, errors.New("extract cannot be used together with to")
+	case params.Version != "" && !params.Extract:
+		return params, errors.New("version should be used together with extract")
+	}
+	return params, nil
+}
+
+func decodeStrict(data json.RawMessage, params any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(params); err != nil {
+		return errors.Wrap(err, "cannot decode parameters")
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+// Package ingest archives OCFL objects in the DLZA. It contains the logic of "ona ingest" for use in other Go
+// programs:
+//
+//	ingester, err := ingest.NewIngester(configObj, logger)
+//	result, err := ingester.Ingest(ctx, ingest.Source{Path: "/data/123-345.zip"}, ingest.Options{Wait: true})
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/filesystem/v3/pkg/osfsrw"
+	"github.com/je4/filesystem/v3/pkg/writefs"
+	"github.com/je4/filesystem/v3/pkg/zipfs"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	gocflCmd "github.com/ocfl-archive/gocfl/v2/gocfl/cmd"
+	"github.com/ocfl-archive/gocfl/v2/pkg/ocfl"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"github.com/ocfl-archive/ona/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// archiving states of the manager
+const (
+	StatusInitialCopying = "initial copying"
+	StatusArchived       = "archived"
+	StatusError          = "error"
+	StatusAborted        = "aborted"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+)
+
+const (
+	ErrChecksumMissing = errors.Sentinel("checksum file is missing, provide the checksum or compute it")
+	ErrExists          = errors.Sentinel("object already exists in the archive")
+	ErrNoPartition     = errors.Sentinel("no storage partition available")
+	ErrCancelled       = errors.Sentinel("ingest cancelled")
+	ErrStoppedWaiting  = errors.Sentinel("stopped waiting for the archiving status, the archiving continues on the server")
+)
+
+var partitionIdRegexp = regexp.MustCompile("^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$")
+
+// Source is the object to ingest
+type Source struct {
+	// Path of the OCFL zip file
+	Path string
+	// MetadataPath is an optional json file with gocfl metadata or a models.Object. Without it, the metadata is
+	// extracted from the zip file. gocfl metadata is uploaded together with the zip file.
+	MetadataPath string
+	// Checksum is the sha512 checksum of the zip file. If empty, the checksum file <Path>.sha512 is read.
+	Checksum string
+}
+
+// Options control an ingest
+type Options struct {
+	// ComputeChecksum calculates the checksum instead of reading the checksum file
+	ComputeChecksum bool
+	// Wait until the manager has archived the object or reported an error
+	Wait bool
+	// PollInterval of the archiving status if Wait is set, 10 seconds if 0
+	PollInterval time.Duration
+	// Progress reports checksum calculation and uploads, may be nil
+	Progress progress.Reporter
+	Hooks    Hooks
+}
+
+// Hooks are called during an ingest, an error of a hook stops the ingest
+type Hooks struct {
+	// BeforeUpload is called when the object is checked and before anything is changed in the archive,
+	// e.g. to ask for confirmation or to complete the metadata. Return ErrCancelled to stop without error.
+	BeforeUpload func(ctx context.Context, object *models.Object) error
+	// AfterUpload is called when all files are uploaded, the archiving continues on the server
+	AfterUpload func(ctx context.Context, result Result) error
+	// AfterArchive is called with the final archiving status, if Options.Wait is set
+	AfterArchive func(ctx context.Context, result Result) error
+}
+
+// Result describes an ingest
+type Result struct {
+	Signature   string `json:"signature"`
+	ObjectId    string `json:"object-id,omitempty"`
+	StatusId    string `json:"status-id,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	Size        int64  `json:"size"`
+	PartitionId string `json:"partition-id,omitempty"`
+	Head        string `json:"head,omitempty"`
+}
+
+// Ingester archives objects. It can be used for several concurrent ingests.
+type Ingester struct {
+	config           configuration.Config
+	client           *service.Client
+	fsFactory        *writefs.Factory
+	extensionFactory *ocfl.ExtensionFactory
+	logger           zLogger.ZLogger
+}
+
+// NewIngester creates an ingester for the archive given in the configuration
+func NewIngester(config configuration.Config, logger zLogger.ZLogger) (*Ingester, error) {
+	client, err := service.NewClient(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create client")
+	}
+	fsFactory, err := writefs.NewFactory()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create filesystem factory")
+	}
+	if err := fsFactory.Register(zipfs.NewCreateFSFunc(logger), "\\.zip$", writefs.HighFS); err != nil {
+		return nil, errors.Wrap(err, "cannot register zipfs")
+	}
+	if err := fsFactory.Register(osfsrw.NewCreateFSFunc(logger), "", writefs.LowFS); err != nil {
+		return nil, errors.Wrap(err, "cannot register osfs")
+	}
+	extensionFactory, err := gocflCmd.InitExtensionFactory(map[string]string{},
+		"",
+		false,
+		nil,
+		nil,
+		nil,
+		nil,
+		logger,
+		"")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot instantiate extension factory")
+	}
+	return &Ingester{
+		config:           config,
+		client:           client,
+		fsFactory:        fsFactory,
+		extensionFactory: extensionFactory,
+		logger:           logger,
+	}, nil
+}
+
+// WithLogger returns an ingester which logs to logger, e.g. to the log of a job
+func (i *Ingester) WithLogger(logger zLogger.ZLogger) *Ingester {
+	ingester := *i
+	ingester.logger = logger
+	return &ingester
+}
+
+// Client returns the client of the manager
+func (i *Ingester) Client() *service.Client {
+	return i.client
+}
+
+// Ingest checks the object, uploads it and waits for the archiving if options.Wait is set. If the upload is not
+// finished, result.Status is aborted when ctx is cancelled and error otherwise. The manager has no route to update
+// the archiving status, it stays at initial copying on the server.
+func (i *Ingester) Ingest(ctx context.Context, source Source, options Options) (result Result, err error) {
+	filePath := filepath.ToSlash(filepath.Clean(source.Path))
+	ctx, span := tracing.Start(ctx, "ingest", attribute.String("ona.path", filePath))
+	defer func() {
+		span.SetAttributes(attribute.String("ona.signature", result.Signature), attribute.String("ona.status_id", result.StatusId), attribute.String("ona.status", result.Status))
+		tracing.End(span, err)
+	}()
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "cannot read file '%s'", filePath)
+	}
+	reporter := metrics.NewReporter(metrics.OperationIngest)
+	if options.Progress != nil {
+		reporter = progress.Multi(options.Progress, reporter)
+	}
+	checksum, err := i.checksum(ctx, filePath, fileInfo.Size(), source.Checksum, options.ComputeChecksum, reporter)
+	if err != nil {
+		return Result{}, err
+	}
+	object, metadataUpload, err := i.metadata(ctx, filePath, source.MetadataPath)
+	if err != nil {
+		return Result{}, err
+	}
+	object.Checksum = checksum
+	object.Size = fileInfo.Size()
+	result = Result{Signature: object.Signature, Checksum: checksum, Size: object.Size}
+
+	result.Head, err = i.checkObject(ctx, &object)
+	if err != nil {
+		return result, err
+	}
+	result.ObjectId = object.Id
+	//checking whether needed amount of locations is available, if yes, delivering partitionId of first location to copy in
+	result.PartitionId, err = i.client.GetStorageLocationsStatusForCollectionAlias(ctx, object.CollectionId, object.Size, object.Signature, result.Head)
+	if err != nil {
+		return result, errors.Wrap(err, "cannot get storage locations of collection")
+	}
+	if !partitionIdRegexp.MatchString(result.PartitionId) {
+		return result, errors.Wrapf(ErrNoPartition, "collection with alias %s", object.Collection)
+	}
+
+	if options.Hooks.BeforeUpload != nil {
+		if err := options.Hooks.BeforeUpload(ctx, &object); err != nil {
+			return result, err
+		}
+	}
+	archivingStatus, err := i.client.CreateStatus(ctx, models.ArchivingStatus{Status: StatusInitialCopying, CorrelationId: correlation.Id(ctx)})
+	if err != nil {
+		return result, errors.Wrap(err, "cannot create initial status")
+	}
+	result.StatusId = archivingStatus.Id
+	result.Status = StatusInitialCopying
+
+	uploads := []string{filePath}
+	if metadataUpload != "" {
+		uploads = []string{metadataUpload, filePath}
+	}
+	if err := i.upload(ctx, object, result, uploads, reporter); err != nil {
+		result.Status = StatusError
+		if ctx.Err() != nil {
+			result.Status = StatusAborted
+		}
+		return result, err
+	}
+	if options.Hooks.AfterUpload != nil {
+		if err := options.Hooks.AfterUpload(ctx, result); err != nil {
+			return result, err
+		}
+	}
+	if !options.Wait {
+		return result, nil
+	}
+
+	result.Status, err = i.WaitForStatus(ctx, result.StatusId, options.PollInterval)
+	if err != nil {
+		return result, err
+	}
+	if options.Hooks.AfterArchive != nil {
+		if err := options.Hooks.AfterArchive(ctx, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// WaitForStatus polls the archiving status until it is archived or error. If ctx is cancelled, ErrStoppedWaiting
+// is returned with the last status.
+func (i *Ingester) WaitForStatus(ctx context.Context, statusId string, pollInterval time.Duration) (status string, err error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	ctx, span := tracing.Start(ctx, "wait for archiving", attribute.String("ona.status_id", statusId))
+	defer func() {
+		span.SetAttributes(attribute.String("ona.status", status))
+		tracing.End(span, err)
+	}()
+	start := time.Now()
+	metrics.ArchivingWaiting.Inc()
+	defer metrics.ArchivingWaiting.Dec()
+	for {
+		archivingStatus, err := i.client.GetStatus(ctx, statusId)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot get status with id %s", statusId)
+		}
+		metrics.ArchivingStatus.WithLabelValues(archivingStatus.Status).Inc()
+		span.AddEvent("status", trace.WithAttributes(attribute.String("ona.status", archivingStatus.Status)))
+		if archivingStatus.Status == StatusArchived || archivingStatus.Status == StatusError {
+			metrics.ObservePhase(metrics.OperationIngest, metrics.PhaseArchiving, start)
+			return archivingStatus.Status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return archivingStatus.Status, errors.Wrapf(ErrStoppedWaiting, "status %s: %v", statusId, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// checksum returns the given checksum, reads the checksum file or computes the checksum
+func (i *Ingester) checksum(ctx context.Context, filePath string, size int64, checksum string, compute bool, reporter progress.Reporter) (string, error) {
+	if checksum != "" {
+		return checksum, nil
+	}
+	if !compute {
+		checksum, err := service.ReadChecksumFile(filePath)
+		if err != nil {
+			return "", errors.Wrapf(ErrChecksumMissing, "%v", err)
+		}
+		return checksum, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	_, span := tracing.Start(ctx, "checksum", attribute.String("ona.path", filePath), attribute.Int64("ona.size", size))
+	task := reporter.Start(progress.PhaseChecksum, filePath, size)
+	checksum, err = service.Checksum(progress.NewReader(service.NewContextReader(ctx, file), task))
+	task.Finish(err)
+	tracing.End(span, err)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot calculate checksum of '%s'", filePath)
+	}
+	return checksum, nil
+}
+
+// metadata reads the object metadata from the json file or extracts it from the zip file. If the json file
+// contains gocfl metadata, its path is returned for upload.
+func (i *Ingester) metadata(ctx context.Context, filePath string, metadataPath string) (_ models.Object, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "metadata", attribute.String("ona.path", filePath), attribute.String("ona.metadata_path", metadataPath))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	if metadataPath == "" {
+		gocfl := service.NewGocfl(i.extensionFactory, i.fsFactory, i.logger)
+		object, err := gocfl.ExtractMetadata(ctx, filePath)
+		if err != nil {
+			return models.Object{}, "", errors.Wrapf(err, "cannot extract metadata of '%s'", filePath)
+		}
+		object.Binary = false
+		return object, "", nil
+	}
+	metadataPath = filepath.ToSlash(filepath.Clean(metadataPath))
+	jsonObject, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return models.Object{}, "", errors.Wrapf(err, "cannot read json file '%s'", metadataPath)
+	}
+	objectOcfl := ocfl.StorageRootMetadata{}
+	if err := json.Unmarshal(jsonObject, &objectOcfl); err != nil {
+		return models.Object{}, "", errors.Wrapf(err, "cannot parse json file '%s'", metadataPath)
+	}
+	object := models.Object{}
+	upload := ""
+	if objectOcfl.Objects != nil {
+		if object, err = service.GetObjectFromGocflObject(&objectOcfl); err != nil {
+			return models.Object{}, "", err
+		}
+		upload = metadataPath
+	} else if err := json.Unmarshal(jsonObject, &object); err != nil {
+		return models.Object{}, "", errors.Wrapf(err, "cannot parse json file '%s'", metadataPath)
+	}
+	object.Binary = true
+	return object, upload, nil
+}
+
+// checkObject looks for an existing object with the same signature and returns the head of the new version.
+// Objects without instance are only accepted if no object with the same checksum exists.
+func (i *Ingester) checkObject(ctx context.Context, object *models.Object) (string, error) {
+	objectPb, err := i.client.GetObjectBySignature(ctx, object.Signature)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return "", errors.Wrapf(err, "cannot get object %s", object.Signature)
+	}
+	if objectPb.Id == "" {
+		return "v1", nil
+	}
+	head := "v1"
+	objectInstancePb, err := i.client.CheckRawObjectInstanceByObjectId(ctx, objectPb.Id)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return "", errors.Wrapf(err, "cannot check object instances of %s", object.Signature)
+	}
+	if objectInstancePb.Id == "" {
+		objects, err := i.client.GetObjectsByChecksum(ctx, object.Checksum)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot check whether object with checksum %s exists", object.Checksum)
+		}
+		if len(objects.Objects) != 0 {
+			return "", errors.Wrapf(ErrExists, "checksum %s", object.Checksum)
+		}
+		head = "v+"
+	}
+	object.Id = objectPb.Id
+	return head, nil
+}
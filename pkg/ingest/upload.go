@@ -0,0 +1,177 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/eventials/go-tus"
+	"github.com/eventials/go-tus/memorystore"
+	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
+	"github.com/ocfl-archive/ona/models"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"github.com/ocfl-archive/ona/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+// upload sends the files to the TUS server. The object is created in the manager before the first upload,
+// if it does not exist yet.
+func (i *Ingester) upload(ctx context.Context, object models.Object, result Result, paths []string, reporter progress.Reporter) error {
+	objectJsonRaw, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	objectJson := string(objectJsonRaw)
+
+	for index, path := range paths {
+		severalObjects := ""
+		if len(paths) > 1 {
+			severalObjects = strconv.Itoa(index)
+		}
+		fileName := service.SignatureFileName(object.Signature, filepath.Ext(path))
+		// every chunk is sent in its own request, traced as child of the span of the file
+		uploadCtx, span := tracing.Start(ctx, "upload", attribute.String("ona.path", path), attribute.String("ona.file_name", fileName))
+		httpClient := i.client.UploadHTTPClient(uploadCtx)
+		// create the tus client.
+		// the memory store keeps the upload URL, so failed uploads can be resumed
+		store, err := memorystore.NewMemoryStore()
+		if err != nil {
+			tracing.End(span, err)
+			return err
+		}
+		client, err := tus.NewClient(i.config.Url, &tus.Config{ChunkSize: i.config.ChunkSize, Resume: true, Store: store, Header: map[string][]string{
+			"ObjectJson": {objectJson}, "Collection": {object.CollectionId}, "StatusId": {result.StatusId}, "Checksum": {result.Checksum}, "FileName": {fileName}, "PartitionId": {result.PartitionId}, "SeveralObjects": {severalObjects}}, HttpClient: httpClient})
+		if err != nil {
+			tracing.End(span, err)
+			return errors.Wrapf(err, "cannot create client for %s", i.config.Url)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			tracing.End(span, err)
+			return errors.Wrapf(err, "cannot open file '%s'", path)
+		}
+		err = i.uploadFile(uploadCtx, client, file, path, reporter, func() error {
+			if object.Id != "" {
+				return nil
+			}
+			//statusId field is used to transfer partition id
+			objectWithInfo := &pb.ObjectAndFile{StatusId: result.PartitionId, FileName: fileName, Object: objectToPb(object, result.Head)}
+			if err := i.client.CreateObjectAndInstance(ctx, objectWithInfo); err != nil {
+				return errors.Wrap(err, "cannot create object")
+			}
+			return nil
+		})
+		file.Close()
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadFile creates the upload, calls created and uploads the file until it is finished or ctx is cancelled.
+// Failed uploads are resumed at the offset of the server, with the retries of the manager client.
+func (i *Ingester) uploadFile(ctx context.Context, client *tus.Client, file *os.File, path string, reporter progress.Reporter, created func() error) (err error) {
+	upload, err := tus.NewUploadFromFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create upload of '%s'", path)
+	}
+	uploader, err := client.CreateUpload(upload)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create upload for file '%s'", path)
+	}
+	if err := created(); err != nil {
+		return err
+	}
+	task := reporter.Start(progress.PhaseUpload, path, upload.Size())
+	defer func() {
+		task.Finish(err)
+	}()
+	retries, retryWait := i.client.Retries()
+	for attempt := 0; ; attempt++ {
+		uploadErr := runUpload(ctx, uploader, task)
+		switch {
+		case uploadErr == nil:
+			task.Update(upload.Size())
+			return nil
+		case ctx.Err() != nil:
+			return errors.Wrapf(ctx.Err(), "upload of '%s' cancelled", path)
+		case attempt >= retries:
+			return errors.Wrapf(uploadErr, "cannot upload file '%s'", path)
+		}
+		wait := retryWait << attempt
+		i.logger.Warn().Msgf("upload of '%s' failed at offset %d, resuming in %s: %v", path, uploader.Offset(), wait, uploadErr)
+		trace.SpanFromContext(ctx).AddEvent("resume", trace.WithAttributes(attribute.Int64("ona.offset", uploader.Offset()), attribute.String("error", uploadErr.Error())))
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "upload of '%s' cancelled", path)
+		case <-time.After(wait):
+		}
+		metrics.UploadRetries.Inc()
+		if uploader, err = client.ResumeUpload(upload); err != nil {
+			return errors.Wrapf(err, "cannot resume upload of '%s' after %v", path, uploadErr)
+		}
+	}
+}
+
+// runUpload uploads until the upload is finished, fails or ctx is cancelled
+func runUpload(ctx context.Context, uploader *tus.Uploader, task progress.Task) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- uploader.Upload()
+	}()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case <-ctx.Done():
+			uploader.Abort()
+			<-done
+			return ctx.Err()
+		case <-ticker.C:
+			task.Update(uploader.Offset())
+		}
+	}
+}
+
+func objectToPb(object models.Object, head string) *pb.Object {
+	return &pb.Object{
+		Size:              object.Size,
+		Signature:         object.Signature,
+		CollectionId:      object.CollectionId,
+		Collection:        object.Collection,
+		Binary:            object.Binary,
+		Address:           object.Address,
+		AlternativeTitles: object.AlternativeTitles,
+		Checksum:          object.Checksum,
+		Authors:           object.Authors,
+		Description:       object.Description,
+		Keywords:          object.Keywords,
+		Created:           object.Created,
+		Expiration:        object.Expiration,
+		Head:              head,
+		Holding:           object.Holding,
+		Identifiers:       object.Identifiers,
+		IngestWorkflow:    object.IngestWorkflow,
+		LastChanged:       object.LastChanged,
+		References:        object.References,
+		Sets:              object.Sets,
+		Title:             object.Title,
+		User:              object.User,
+	}
+}
@@ -0,0 +1,100 @@
+// Package jobs is a persistent job queue. Jobs are stored as json files in a directory, so queued and interrupted
+// jobs are resumed after a restart. They run with bounded concurrency and failed jobs are retried with backoff.
+//
+//	queue, err := jobs.NewQueue(dir, jobs.Options{Workers: 2}, logger)
+//	queue.Register("ingest", jobs.Handler{Run: runIngest})
+//	go queue.Run(ctx)
+//	job, err := queue.Submit("ingest", params)
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/pkg/progress"
+)
+
+// states of a job
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	ErrNotFound    = errors.Sentinel("job not found")
+	ErrUnknownType = errors.Sentinel("unknown job type")
+	ErrFinished    = errors.Sentinel("job is already finished")
+	ErrNotFinished = errors.Sentinel("job is not finished")
+)
+
+// Job is a unit of work of the queue
+type Job struct {
+	Id       string          `json:"id"`
+	Type     string          `json:"type"`
+	Status   string          `json:"status"`
+	Params   json.RawMessage `json:"params"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Attempts int             `json:"attempts"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	NextRun  *time.Time      `json:"next-run,omitempty"` // earliest start of a retry
+	Progress *Progress       `json:"progress,omitempty"` // latest task of a running job, not stored
+	// CorrelationId of the latest attempt, it is logged and sent to the manager and the TUS server
+	CorrelationId string `json:"correlation-id,omitempty"`
+}
+
+// Progress is the state of the latest task of a job
+type Progress struct {
+	Phase   progress.Phase `json:"phase"`
+	Name    string         `json:"name"`
+	Bytes   int64          `json:"bytes"`
+	Total   int64          `json:"total,omitempty"`
+	Percent float64        `json:"percent,omitempty"`
+	Rate    float64        `json:"rate"`          // bytes per second
+	ETA     float64        `json:"eta,omitempty"` // seconds
+}
+
+// IsFinished reports whether the job reached a final state
+func (j Job) IsFinished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Handler executes the jobs of one type
+type Handler struct {
+	// Validate checks the parameters when a job is submitted, may be nil
+	Validate func(params json.RawMessage) error
+	// Run executes the job. logger writes to the log of the job, the returned result is stored as json.
+	// Errors wrapped with Permanent are not retried. A retry gets the result of the previous attempt in
+	// job.Result, e.g. to continue after steps which are already done.
+	Run func(ctx context.Context, job Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error)
+}
+
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks an error which will not go away with a retry, e.g. invalid parameters
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{error: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
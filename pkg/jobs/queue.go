@@ -0,0 +1,527 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultWorkers   = 2
+	defaultRetries   = 3
+	defaultRetryWait = time.Minute
+	defaultRetention = 30 * 24 * time.Hour
+	pollInterval     = time.Second
+	pruneInterval    = time.Hour
+	jobExt           = ".json"
+	logExt           = ".log"
+)
+
+// Options control the execution of the jobs
+type Options struct {
+	// Workers is the number of jobs running in parallel, 2 if 0
+	Workers int
+	// Retries of a failed job, 3 if 0, -1 disables them
+	Retries int
+	// RetryWait before the first retry, doubled for every further retry, one minute if 0
+	RetryWait time.Duration
+	// ProgressInterval of the progress lines in the job log, progress.DefaultLogInterval if 0
+	ProgressInterval time.Duration
+	// Retention of finished jobs and their logs after they finished, 30 days if 0, negative keeps them
+	Retention time.Duration
+}
+
+// Queue stores the jobs in a directory and runs them
+type Queue struct {
+	sync.Mutex
+	dir       string
+	options   Options
+	handlers  map[string]Handler
+	jobs      map[string]*Job
+	cancels   map[string]context.CancelFunc
+	cancelled map[string]bool
+	trackers  map[string]*progress.Tracker
+	wake      chan struct{}
+	logger    zLogger.ZLogger
+}
+
+// NewQueue opens the queue in dir. Jobs which were running when the queue was stopped are queued again.
+func NewQueue(dir string, options Options, logger zLogger.ZLogger) (*Queue, error) {
+	if options.Workers <= 0 {
+		options.Workers = defaultWorkers
+	}
+	switch {
+	case options.Retries == 0:
+		options.Retries = defaultRetries
+	case options.Retries < 0:
+		options.Retries = 0
+	}
+	if options.RetryWait <= 0 {
+		options.RetryWait = defaultRetryWait
+	}
+	if options.Retention == 0 {
+		options.Retention = defaultRetention
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "cannot create job directory '%s'", dir)
+	}
+	q := &Queue{
+		dir:       dir,
+		options:   options,
+		handlers:  map[string]Handler{},
+		jobs:      map[string]*Job{},
+		cancels:   map[string]context.CancelFunc{},
+		cancelled: map[string]bool{},
+		trackers:  map[string]*progress.Tracker{},
+		wake:      make(chan struct{}, 1),
+		logger:    logger,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read job directory '%s'", q.dir)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), jobExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, entry.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "cannot read job '%s'", entry.Name())
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			q.logger.Error().Msgf("cannot unmarshal job '%s': %v", entry.Name(), err)
+			continue
+		}
+		if job.Status == StatusRunning {
+			job.Status = StatusQueued
+			if err := q.save(job); err != nil {
+				return err
+			}
+			q.logger.Info().Msgf("job %s was interrupted and is queued again", job.Id)
+		}
+		q.jobs[job.Id] = job
+	}
+	return nil
+}
+
+// save writes the job atomically, the caller holds the lock
+func (q *Queue) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal job %s", job.Id)
+	}
+	jobPath := filepath.Join(q.dir, job.Id+jobExt)
+	if err := os.WriteFile(jobPath+".tmp", data, 0600); err != nil {
+		return errors.Wrapf(err, "cannot write job %s", job.Id)
+	}
+	if err := os.Rename(jobPath+".tmp", jobPath); err != nil {
+		return errors.Wrapf(err, "cannot write job %s", job.Id)
+	}
+	return nil
+}
+
+// Register adds the handler of a job type, it has to be called before Run
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.Lock()
+	defer q.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Types returns the registered job types
+func (q *Queue) Types() []string {
+	q.Lock()
+	defer q.Unlock()
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Submit validates the parameters and queues a new job
+func (q *Queue) Submit(jobType string, params json.RawMessage) (Job, error) {
+	q.Lock()
+	handler, ok := q.handlers[jobType]
+	q.Unlock()
+	if !ok {
+		return Job{}, errors.Wrapf(ErrUnknownType, "'%s'", jobType)
+	}
+	if handler.Validate != nil {
+		if err := handler.Validate(params); err != nil {
+			return Job{}, errors.Wrap(err, "invalid parameters")
+		}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, errors.Wrap(err, "cannot create job id")
+	}
+	job := &Job{
+		Id:      hex.EncodeToString(id),
+		Type:    jobType,
+		Status:  StatusQueued,
+		Params:  params,
+		Created: time.Now(),
+	}
+	q.Lock()
+	defer q.Unlock()
+	if err := q.save(job); err != nil {
+		return Job{}, err
+	}
+	q.jobs[job.Id] = job
+	q.logger.Info().Msgf("job %s (%s) queued", job.Id, job.Type)
+	q.notify()
+	return *job, nil
+}
+
+// Get returns the job with the given id
+func (q *Queue) Get(id string) (Job, error) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, errors.Wrapf(ErrNotFound, "'%s'", id)
+	}
+	return q.view(job), nil
+}
+
+// List returns the jobs with the given status, all jobs if status is empty, oldest first
+func (q *Queue) List(status string) []Job {
+	q.Lock()
+	defer q.Unlock()
+	result := []Job{}
+	for _, job := range q.jobs {
+		if status == "" || job.Status == status {
+			result = append(result, q.view(job))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result
+}
+
+// view returns a copy of the job with the progress of a running job, the caller holds the lock
+func (q *Queue) view(job *Job) Job {
+	result := *job
+	if tracker, ok := q.trackers[job.Id]; ok {
+		if snapshot, ok := tracker.Snapshot(); ok {
+			result.Progress = &Progress{
+				Phase:   snapshot.Phase,
+				Name:    snapshot.Name,
+				Bytes:   snapshot.Done,
+				Total:   snapshot.Total,
+				Percent: snapshot.Percent(),
+				Rate:    snapshot.Rate,
+				ETA:     snapshot.ETA.Seconds(),
+			}
+		}
+	}
+	return result
+}
+
+// Retry queues a failed or cancelled job again with a new set of attempts
+func (q *Queue) Retry(id string) (Job, error) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, errors.Wrapf(ErrNotFound, "'%s'", id)
+	}
+	if job.Status != StatusFailed && job.Status != StatusCancelled {
+		return *job, errors.Wrapf(ErrNotFinished, "'%s' is %s", id, job.Status)
+	}
+	job.Status = StatusQueued
+	job.Attempts = 0
+	job.Finished = nil
+	job.NextRun = nil
+	if err := q.save(job); err != nil {
+		return Job{}, err
+	}
+	q.logger.Info().Msgf("job %s queued again", job.Id)
+	q.notify()
+	return *job, nil
+}
+
+// Counts returns the number of jobs per status
+func (q *Queue) Counts() map[string]int {
+	q.Lock()
+	defer q.Unlock()
+	counts := map[string]int{StatusQueued: 0, StatusRunning: 0, StatusSucceeded: 0, StatusFailed: 0, StatusCancelled: 0}
+	for _, job := range q.jobs {
+		counts[job.Status]++
+	}
+	return counts
+}
+
+// Cancel stops a queued or running job
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.Lock()
+	defer q.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, errors.Wrapf(ErrNotFound, "'%s'", id)
+	}
+	switch job.Status {
+	case StatusQueued:
+		now := time.Now()
+		job.Status = StatusCancelled
+		job.Finished = &now
+		job.NextRun = nil
+		if err := q.save(job); err != nil {
+			return Job{}, err
+		}
+		q.logger.Info().Msgf("job %s cancelled", job.Id)
+	case StatusRunning:
+		q.cancelled[id] = true
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+	default:
+		return *job, errors.Wrapf(ErrFinished, "'%s' is %s", id, job.Status)
+	}
+	return *job, nil
+}
+
+// LogPath returns the path of the log file of the job
+func (q *Queue) LogPath(id string) (string, error) {
+	if _, err := q.Get(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(q.dir, id+logExt), nil
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Prune removes the jobs which finished before the retention period, together with their logs
+func (q *Queue) Prune(now time.Time) error {
+	if q.options.Retention < 0 {
+		return nil
+	}
+	q.Lock()
+	defer q.Unlock()
+	var errs []error
+	for id, job := range q.jobs {
+		if job.Finished == nil || job.Status == StatusQueued || job.Status == StatusRunning ||
+			now.Sub(*job.Finished) < q.options.Retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(q.dir, id+logExt)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "cannot remove log of job %s", id))
+			continue
+		}
+		if err := os.Remove(filepath.Join(q.dir, id+jobExt)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "cannot remove job %s", id))
+			continue
+		}
+		delete(q.jobs, id)
+		q.logger.Debug().Msgf("job %s removed", id)
+	}
+	return errors.Combine(errs...)
+}
+
+// Run executes the jobs until ctx is cancelled. Running jobs are interrupted and queued again. Finished jobs
+// are pruned every hour.
+func (q *Queue) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			if err := q.Prune(time.Now()); err != nil {
+				q.logger.Error().Msgf("cannot prune jobs: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	for i := 0; i < q.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				job, handler := q.next()
+				if job == nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-q.wake:
+					case <-time.After(pollInterval):
+					}
+					continue
+				}
+				q.run(ctx, job, handler)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// next marks the oldest job which is due as running
+func (q *Queue) next() (*Job, Handler) {
+	q.Lock()
+	defer q.Unlock()
+	now := time.Now()
+	var next *Job
+	for _, job := range q.jobs {
+		if job.Status != StatusQueued || (job.NextRun != nil && job.NextRun.After(now)) {
+			continue
+		}
+		if _, ok := q.handlers[job.Type]; !ok {
+			continue
+		}
+		if next == nil || job.Created.Before(next.Created) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, Handler{}
+	}
+	next.Status = StatusRunning
+	next.Started = &now
+	next.NextRun = nil
+	next.Attempts++
+	next.CorrelationId = correlation.NewId()
+	if err := q.save(next); err != nil {
+		q.logger.Error().Msgf("%v", err)
+	}
+	return next, q.handlers[next.Type]
+}
+
+func (q *Queue) run(ctx context.Context, job *Job, handler Handler) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.Lock()
+	q.cancels[job.Id] = cancel
+	if q.cancelled[job.Id] {
+		cancel()
+	}
+	snapshot := *job
+	q.Unlock()
+
+	q.logger.Info().Str(correlation.LogField, snapshot.CorrelationId).Msgf("job %s (%s) started, attempt %d", job.Id, job.Type, snapshot.Attempts)
+	result, err := q.execute(jobCtx, snapshot, handler)
+
+	q.Lock()
+	defer q.Unlock()
+	delete(q.cancels, job.Id)
+	cancelled := q.cancelled[job.Id]
+	delete(q.cancelled, job.Id)
+	now := time.Now()
+	switch {
+	case cancelled:
+		job.Status = StatusCancelled
+		job.Error = "cancelled"
+		job.Finished = &now
+		q.logger.Info().Msgf("job %s cancelled", job.Id)
+	case ctx.Err() != nil:
+		// shutdown, the job is resumed after the restart
+		job.Status = StatusQueued
+		job.Attempts--
+		job.Result = result
+		q.logger.Info().Msgf("job %s interrupted", job.Id)
+	case err == nil:
+		job.Status = StatusSucceeded
+		job.Error = ""
+		job.Result = result
+		job.Finished = &now
+		q.logger.Info().Msgf("job %s (%s) succeeded", job.Id, job.Type)
+	case !IsPermanent(err) && job.Attempts <= q.options.Retries:
+		job.Status = StatusQueued
+		job.Error = err.Error()
+		job.Result = result
+		nextRun := now.Add(q.options.RetryWait << (job.Attempts - 1))
+		job.NextRun = &nextRun
+		q.logger.Warn().Msgf("job %s failed, retry at %s: %v", job.Id, nextRun.Format(time.RFC3339), err)
+	default:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		job.Result = result
+		job.Finished = &now
+		q.logger.Error().Msgf("job %s (%s) failed: %v", job.Id, job.Type, err)
+	}
+	if err := q.save(job); err != nil {
+		q.logger.Error().Msgf("%v", err)
+	}
+}
+
+// execute runs the handler with a logger and a progress reporter writing to the log of the job
+func (q *Queue) execute(ctx context.Context, job Job, handler Handler) (_ json.RawMessage, err error) {
+	logFile, err := os.OpenFile(filepath.Join(q.dir, job.Id+logExt), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open log of job %s", job.Id)
+	}
+	defer logFile.Close()
+	// every attempt is a trace of its own
+	ctx = correlation.WithId(ctx, job.CorrelationId)
+	ctx, span := tracing.Tracer().Start(ctx, "job "+job.Type, trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("ona.job.id", job.Id), attribute.Int("ona.job.attempt", job.Attempts), attribute.String("ona.correlation_id", job.CorrelationId)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	logContext := zerolog.New(logFile).With().Timestamp().Str("job", job.Id).Int("attempt", job.Attempts).Str(correlation.LogField, job.CorrelationId)
+	if span.SpanContext().IsValid() {
+		logContext = logContext.Str("trace", span.SpanContext().TraceID().String())
+	}
+	jobLogger := logContext.Logger()
+	tracker := progress.NewTracker()
+	q.Lock()
+	q.trackers[job.Id] = tracker
+	q.Unlock()
+	defer func() {
+		q.Lock()
+		delete(q.trackers, job.Id)
+		q.Unlock()
+	}()
+	reporter := progress.Multi(progress.NewLog(&jobLogger, q.options.ProgressInterval), tracker)
+
+	result, err := handler.Run(ctx, job, &jobLogger, reporter)
+	if err != nil {
+		jobLogger.Error().Msgf("%v", err)
+	}
+	if result == nil {
+		return nil, err
+	}
+	data, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return nil, errors.Combine(err, errors.Wrap(marshalErr, "cannot marshal result"))
+	}
+	return data, err
+}
@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/rs/zerolog"
+)
+
+func newTestQueue(t *testing.T, dir string, options Options) *Queue {
+	t.Helper()
+	logger := zerolog.Nop()
+	queue, err := NewQueue(dir, options, &logger)
+	if err != nil {
+		t.Fatalf("cannot open queue: %v", err)
+	}
+	return queue
+}
+
+// runUntilFinished runs the queue until the job is finished
+func runUntilFinished(t *testing.T, queue *Queue, id string) Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for {
+		job, err := queue.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.IsFinished() {
+			return job
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("job %s is still %s", id, job.Status)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestQueuePersistence(t *testing.T) {
+	dir := t.TempDir()
+	queue := newTestQueue(t, dir, Options{})
+	queue.Register("test", Handler{})
+	first, err := queue.Submit("test", json.RawMessage(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := queue.Submit("test", json.RawMessage(`{"n":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first job is running when the queue stops
+	if running, _ := queue.next(); running == nil || running.Id != first.Id {
+		t.Fatalf("expected job %s to run", first.Id)
+	}
+
+	reopened := newTestQueue(t, dir, Options{})
+	for _, id := range []string{first.Id, second.Id} {
+		job, err := reopened.Get(id)
+		if err != nil {
+			t.Fatalf("job %s not loaded: %v", id, err)
+		}
+		if job.Status != StatusQueued {
+			t.Errorf("job %s is %s, expected %s", id, job.Status, StatusQueued)
+		}
+	}
+	job, _ := reopened.Get(first.Id)
+	if job.Attempts != 1 {
+		t.Errorf("job %s has %d attempts, expected 1", first.Id, job.Attempts)
+	}
+	params := struct{ N int }{}
+	if err := json.Unmarshal(job.Params, &params); err != nil || params.N != 1 {
+		t.Errorf("job %s has params %s", first.Id, job.Params)
+	}
+	if _, err := reopened.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	failure := errors.New("temporary failure")
+	tests := []struct {
+		name     string
+		options  Options
+		failures int32
+		err      error
+		status   string
+		attempts int
+	}{
+		{"success", Options{}, 0, failure, StatusSucceeded, 1},
+		{"retry", Options{RetryWait: time.Millisecond}, 1, failure, StatusSucceeded, 2},
+		{"no retries", Options{Retries: -1}, 1, failure, StatusFailed, 1},
+		{"permanent", Options{}, 1, Permanent(failure), StatusFailed, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newTestQueue(t, t.TempDir(), test.options)
+			var calls atomic.Int32
+			queue.Register("test", Handler{
+				Run: func(ctx context.Context, job Job, logger zLogger.ZLogger, reporter progress.Reporter) (any, error) {
+					call := calls.Add(1)
+					if call <= test.failures {
+						return map[string]int32{"call": call}, test.err
+					}
+					return map[string]int32{"call": call}, nil
+				},
+			})
+			submitted, err := queue.Submit("test", json.RawMessage(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := runUntilFinished(t, queue, submitted.Id)
+			if job.Status != test.status {
+				t.Errorf("job is %s, expected %s", job.Status, test.status)
+			}
+			if job.Attempts != test.attempts {
+				t.Errorf("job has %d attempts, expected %d", job.Attempts, test.attempts)
+			}
+			if expected := fmt.Sprintf(`{"call":%d}`, test.attempts); string(job.Result) != expected {
+				t.Errorf("job has result %s, expected %s", job.Result, expected)
+			}
+			if test.status == StatusFailed && job.Error != failure.Error() {
+				t.Errorf("job has error %q, expected %q", job.Error, failure.Error())
+			}
+			if _, err := os.Stat(filepath.Join(queue.dir, job.Id+logExt)); err != nil {
+				t.Errorf("no log of job: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueValidate(t *testing.T) {
+	queue := newTestQueue(t, t.TempDir(), Options{})
+	queue.Register("test", Handler{
+		Validate: func(params json.RawMessage) error {
+			return errors.New("invalid")
+		},
+	})
+	if _, err := queue.Submit("test", json.RawMessage(`{}`)); err == nil {
+		t.Error("expected validation error")
+	}
+	if _, err := queue.Submit("other", json.RawMessage(`{}`)); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected ErrUnknownType, got %v", err)
+	}
+	if jobs := queue.List(""); len(jobs) != 0 {
+		t.Errorf("expected no jobs, got %d", len(jobs))
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	dir := t.TempDir()
+	queue := newTestQueue(t, dir, Options{Retention: time.Hour})
+	queue.Register("test", Handler{})
+	finished, err := queue.Submit("test", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := queue.Submit("test", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Cancel(finished.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, finished.Id+logExt), []byte("log\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := queue.Prune(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Get(finished.Id); err != nil {
+		t.Errorf("job %s removed before the retention period: %v", finished.Id, err)
+	}
+
+	if err := queue.Prune(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Get(finished.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("job %s not removed", finished.Id)
+	}
+	for _, name := range []string{finished.Id + jobExt, finished.Id + logExt} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", name)
+		}
+	}
+	if _, err := queue.Get(queued.Id); err != nil {
+		t.Errorf("queued job %s removed: %v", queued.Id, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package metrics contains the Prometheus metrics of ona. They are collected in Registry and exposed with
+// Handler for daemons or written with WriteTextfile for the textfile collector of the node exporter after
+// batch runs.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ona"
+
+// transfer directions
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// operations
+const (
+	OperationIngest = "ingest"
+	OperationCopy   = "copy"
+	OperationAudit  = "audit"
+)
+
+// PhaseArchiving is the wait for the archiving status after an upload
+const PhaseArchiving = "archiving"
+
+// Registry contains all metrics of ona and the Go and process metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	TransferredBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Bytes uploaded to the TUS server or downloaded from storage.",
+	}, []string{"direction"})
+	PhaseDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of the phases of ingests and copies: checksum, upload, archiving, download and packaging.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 10),
+	}, []string{"operation", "phase"})
+	ManagerRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "manager_request_duration_seconds",
+		Help:      "Latency of requests to the manager API by endpoint and status code, code is error if there was no response.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method", "code"})
+	UploadRetries = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tus_retries_total",
+		Help:      "Uploads to the TUS server resumed after an error.",
+	})
+	ChecksumFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checksum_failures_total",
+		Help:      "Objects or local files whose checksum did not match the checksum of the archive.",
+	}, []string{"operation"})
+	ArchivingStatus = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "archiving_status_total",
+		Help:      "Archiving statuses seen while waiting for ingests, counted once per poll.",
+	}, []string{"status"})
+	ArchivingWaiting = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "archiving_waiting",
+		Help:      "Ingests currently waiting for the archiving.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// ObservePhase records the duration of a phase which started at start
+func ObservePhase(operation string, phase string, start time.Time) {
+	PhaseDuration.WithLabelValues(operation, phase).Observe(time.Since(start).Seconds())
+}
+
+// Handler returns the http handler of the metrics endpoint
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// WriteTextfile writes the metrics in the text format to path, e.g. for the textfile collector of the node
+// exporter. The file is replaced atomically.
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
+
+// RegisterQueue exposes the number of jobs per status, counts is called on every scrape
+func RegisterQueue(counts func() map[string]int) {
+	Registry.MustRegister(&queueCollector{counts: counts})
+}
+
+var queueJobs = prometheus.NewDesc(prometheus.BuildFQName(namespace, "queue", "jobs"), "Jobs of the ona serve queue by status.", []string{"status"}, nil)
+
+type queueCollector struct {
+	counts func() map[string]int
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueJobs
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, count := range c.counts() {
+		ch <- prometheus.MustNewConstMetric(queueJobs, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ocfl-archive/ona/pkg/progress"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewReporter returns a progress reporter which counts the transferred bytes and records the duration of every
+// finished task as a phase of operation
+func NewReporter(operation string) progress.Reporter {
+	return &reporter{operation: operation}
+}
+
+type reporter struct {
+	operation string
+}
+
+func (r *reporter) Start(phase progress.Phase, name string, total int64) progress.Task {
+	task := &task{operation: r.operation, phase: phase, start: time.Now()}
+	switch phase {
+	case progress.PhaseUpload:
+		task.bytes = TransferredBytes.WithLabelValues(DirectionUpload)
+	case progress.PhaseDownload:
+		task.bytes = TransferredBytes.WithLabelValues(DirectionDownload)
+	}
+	return task
+}
+
+type task struct {
+	sync.Mutex
+	operation string
+	phase     progress.Phase
+	start     time.Time
+	bytes     prometheus.Counter // nil for phases without transfer
+	done      int64
+}
+
+func (t *task) Update(done int64) {
+	t.Lock()
+	defer t.Unlock()
+	if t.bytes != nil && done > t.done {
+		t.bytes.Add(float64(done - t.done))
+	}
+	t.done = done
+}
+
+func (t *task) Finish(err error) {
+	if err != nil {
+		return
+	}
+	ObservePhase(t.operation, string(t.phase), t.start)
+}
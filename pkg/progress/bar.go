@@ -0,0 +1,62 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// NewBar returns a reporter with an interactive progress bar for terminals. Concurrent tasks share the output,
+// so it is meant for one task at a time.
+func NewBar(w io.Writer) Reporter {
+	return &barReporter{w: w}
+}
+
+type barReporter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (r *barReporter) Start(phase Phase, name string, total int64) Task {
+	r.Lock()
+	defer r.Unlock()
+	if total <= 0 {
+		total = -1
+	}
+	bar := progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetDescription(fmt.Sprintf("%s %s", phase, name)),
+		progressbar.OptionSetWriter(r.w),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprintln(r.w)
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+	return &barTask{bar: bar, w: r.w}
+}
+
+type barTask struct {
+	bar *progressbar.ProgressBar
+	w   io.Writer
+}
+
+func (t *barTask) Update(done int64) {
+	t.bar.Set64(done)
+}
+
+func (t *barTask) Finish(err error) {
+	if err != nil {
+		t.bar.Exit()
+		fmt.Fprintf(t.w, "\nfailed: %v\n", err)
+		return
+	}
+	t.bar.Finish()
+}
@@ -0,0 +1,36 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"emperror.dev/errors"
+)
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int64
+		err   error
+		want  string
+	}{
+		{name: "finished", total: 100},
+		{name: "unknown total"},
+		{name: "failed", total: 100, err: errors.New("connection reset"), want: "failed: connection reset"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			task := NewBar(buf).Start(PhaseDownload, "object.zip", test.total)
+			task.Update(50)
+			task.Finish(test.err)
+			if !strings.Contains(buf.String(), "download object.zip") {
+				t.Errorf("expected description in %q", buf.String())
+			}
+			if test.want != "" && !strings.Contains(buf.String(), test.want) {
+				t.Errorf("expected %q in %q", test.want, buf.String())
+			}
+		})
+	}
+}
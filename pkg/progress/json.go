@@ -0,0 +1,79 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const jsonInterval = 500 * time.Millisecond
+
+// Event is a line written by the JSON reporter
+type Event struct {
+	Time    string  `json:"time"`
+	Event   string  `json:"event"` // start, progress, done or error
+	Phase   Phase   `json:"phase"`
+	Name    string  `json:"name"`
+	Bytes   int64   `json:"bytes"`
+	Total   int64   `json:"total,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+	Rate    float64 `json:"rate"`          // bytes per second
+	ETA     float64 `json:"eta,omitempty"` // seconds
+	Error   string  `json:"error,omitempty"`
+}
+
+// NewJSON returns a reporter which writes newline-delimited JSON events for GUIs and CI systems
+func NewJSON(w io.Writer) Reporter {
+	return &jsonReporter{encoder: json.NewEncoder(w)}
+}
+
+type jsonReporter struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+func (r *jsonReporter) write(event string, snapshot Snapshot, err error) {
+	e := Event{
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Event:   event,
+		Phase:   snapshot.Phase,
+		Name:    snapshot.Name,
+		Bytes:   snapshot.Done,
+		Total:   snapshot.Total,
+		Percent: snapshot.Percent(),
+		Rate:    snapshot.Rate,
+		ETA:     snapshot.ETA.Seconds(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.encoder.Encode(e)
+}
+
+func (r *jsonReporter) Start(phase Phase, name string, total int64) Task {
+	task := &jsonTask{reporter: r, meter: newMeter(phase, name, total, jsonInterval)}
+	r.write("start", task.meter.snapshot(), nil)
+	return task
+}
+
+type jsonTask struct {
+	reporter *jsonReporter
+	meter    *meter
+}
+
+func (t *jsonTask) Update(done int64) {
+	if t.meter.update(done) {
+		t.reporter.write("progress", t.meter.snapshot(), nil)
+	}
+}
+
+func (t *jsonTask) Finish(err error) {
+	if err != nil {
+		t.reporter.write("error", t.meter.snapshot(), err)
+		return
+	}
+	t.reporter.write("done", t.meter.snapshot(), nil)
+}
@@ -0,0 +1,72 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+func readEvents(t *testing.T, buf *bytes.Buffer) []Event {
+	t.Helper()
+	var events []Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, event.Time); err != nil {
+			t.Errorf("invalid time %q", event.Time)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  int64
+		err    error
+		events []string
+	}{
+		{name: "done", total: 100, events: []string{"start", "progress", "done"}},
+		{name: "unknown total", events: []string{"start", "progress", "done"}},
+		{name: "error", total: 100, err: errors.New("connection reset"), events: []string{"start", "progress", "error"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			task := NewJSON(buf).Start(PhaseUpload, "object.zip", test.total)
+			// updates within the interval are not written
+			task.Update(10)
+			task.Update(20)
+			task.(*jsonTask).meter.last = time.Now().Add(-time.Second)
+			task.Update(50)
+			task.Finish(test.err)
+			events := readEvents(t, buf)
+			if len(events) != len(test.events) {
+				t.Fatalf("expected events %v, got %+v", test.events, events)
+			}
+			for index, event := range events {
+				if event.Event != test.events[index] || event.Phase != PhaseUpload || event.Name != "object.zip" || event.Total != test.total {
+					t.Errorf("unexpected event %+v", event)
+				}
+			}
+			last := events[len(events)-1]
+			if last.Bytes != 50 {
+				t.Errorf("expected 50 bytes, got %d", last.Bytes)
+			}
+			if test.total > 0 && last.Percent != 50 {
+				t.Errorf("expected 50%%, got %.1f%%", last.Percent)
+			}
+			if test.err != nil && last.Error != test.err.Error() {
+				t.Errorf("expected error %q, got %q", test.err, last.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package progress
+
+import (
+	"time"
+
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// DefaultLogInterval is the interval of the log reporter if none is given
+const DefaultLogInterval = 10 * time.Second
+
+// NewLog returns a reporter which writes a log line at start and end of every task and every interval in between,
+// for daemons and log files
+func NewLog(logger zLogger.ZLogger, interval time.Duration) Reporter {
+	if interval <= 0 {
+		interval = DefaultLogInterval
+	}
+	return &logReporter{logger: logger, interval: interval}
+}
+
+type logReporter struct {
+	logger   zLogger.ZLogger
+	interval time.Duration
+}
+
+func (r *logReporter) Start(phase Phase, name string, total int64) Task {
+	r.logger.Info().Msgf("%s of %s started, %d bytes", phase, name, total)
+	return &logTask{logger: r.logger, meter: newMeter(phase, name, total, r.interval)}
+}
+
+type logTask struct {
+	logger zLogger.ZLogger
+	meter  *meter
+}
+
+func (t *logTask) Update(done int64) {
+	if !t.meter.update(done) {
+		return
+	}
+	s := t.meter.snapshot()
+	t.logger.Info().Msgf("%s of %s: %d of %d bytes (%.1f%%), %.1f MB/s, %s remaining",
+		s.Phase, s.Name, s.Done, s.Total, s.Percent(), s.Rate/1e6, s.ETA.Round(time.Second))
+}
+
+func (t *logTask) Finish(err error) {
+	s := t.meter.snapshot()
+	if err != nil {
+		t.logger.Error().Msgf("%s of %s failed after %d bytes: %v", s.Phase, s.Name, s.Done, err)
+		return
+	}
+	t.logger.Info().Msgf("%s of %s finished, %d bytes in %s", s.Phase, s.Name, s.Done, s.Elapsed.Round(time.Millisecond))
+}
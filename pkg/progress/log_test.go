@@ -0,0 +1,53 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		lines []string
+	}{
+		{name: "finished", lines: []string{"upload of object.zip started, 100 bytes", "upload of object.zip: 50 of 100 bytes (50.0%)", "upload of object.zip finished, 100 bytes"}},
+		{name: "failed", err: errors.New("connection reset"), lines: []string{"upload of object.zip started", "upload of object.zip: 50 of 100 bytes", "upload of object.zip failed after 100 bytes: connection reset"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := zerolog.New(buf)
+			task := NewLog(&logger, time.Hour).Start(PhaseUpload, "object.zip", 100)
+			task.Update(10)
+			task.(*logTask).meter.last = time.Now().Add(-2 * time.Hour)
+			task.Update(50)
+			task.Update(100)
+			task.Finish(test.err)
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != len(test.lines) {
+				t.Fatalf("expected %d lines, got %q", len(test.lines), lines)
+			}
+			for index, line := range lines {
+				if !strings.Contains(line, test.lines[index]) {
+					t.Errorf("expected %q in %q", test.lines[index], line)
+				}
+			}
+			if test.err != nil && !strings.Contains(lines[len(lines)-1], `"level":"error"`) {
+				t.Errorf("failure should be logged as error: %s", lines[len(lines)-1])
+			}
+		})
+	}
+}
+
+func TestLogDefaultInterval(t *testing.T) {
+	logger := zerolog.Nop()
+	if reporter := NewLog(&logger, 0).(*logReporter); reporter.interval != DefaultLogInterval {
+		t.Errorf("expected interval %v, got %v", DefaultLogInterval, reporter.interval)
+	}
+}
@@ -0,0 +1,128 @@
+// Package progress reports the progress of long running operations like uploads, downloads and checksum
+// calculations. The reporters render a progress bar, newline-delimited JSON events or log lines.
+package progress
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Phase is the kind of operation of a task
+type Phase string
+
+const (
+	PhaseChecksum  Phase = "checksum"
+	PhaseUpload    Phase = "upload"
+	PhaseDownload  Phase = "download"
+	PhasePackaging Phase = "packaging"
+)
+
+// Reporter creates a Task for every operation. Reporters are safe for concurrent use.
+type Reporter interface {
+	// Start begins a task of total bytes, total is 0 if unknown
+	Start(phase Phase, name string, total int64) Task
+}
+
+// Task is a single operation. Update may be called as often as needed, the reporters limit their output.
+type Task interface {
+	// Update sets the number of processed bytes
+	Update(done int64)
+	// Finish ends the task, err is nil on success
+	Finish(err error)
+}
+
+// Nop returns a reporter without output
+func Nop() Reporter {
+	return nopReporter{}
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Start(Phase, string, int64) Task { return nopTask{} }
+
+type nopTask struct{}
+
+func (nopTask) Update(int64) {}
+func (nopTask) Finish(error) {}
+
+// NewReader returns a reader which updates task with the number of bytes read
+func NewReader(r io.Reader, task Task) io.Reader {
+	return &reader{r: r, task: task}
+}
+
+type reader struct {
+	r    io.Reader
+	task Task
+	done int64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.done += int64(n)
+	r.task.Update(r.done)
+	return n, err
+}
+
+// Snapshot is the state of a task with rate and estimated remaining time
+type Snapshot struct {
+	Phase   Phase
+	Name    string
+	Done    int64
+	Total   int64
+	Elapsed time.Duration
+	// Rate in bytes per second
+	Rate float64
+	// ETA is the estimated remaining time, 0 if unknown
+	ETA time.Duration
+}
+
+// Percent returns the progress in percent, 0 if the total is unknown
+func (s Snapshot) Percent() float64 {
+	if s.Total <= 0 {
+		return 0
+	}
+	return float64(s.Done) * 100 / float64(s.Total)
+}
+
+// meter tracks a task and limits the updates to one per interval
+type meter struct {
+	sync.Mutex
+	phase    Phase
+	name     string
+	total    int64
+	done     int64
+	start    time.Time
+	last     time.Time
+	interval time.Duration
+}
+
+func newMeter(phase Phase, name string, total int64, interval time.Duration) *meter {
+	now := time.Now()
+	return &meter{phase: phase, name: name, total: total, start: now, last: now, interval: interval}
+}
+
+// update stores done and reports whether the interval since the last output has passed
+func (m *meter) update(done int64) bool {
+	m.Lock()
+	defer m.Unlock()
+	m.done = done
+	if time.Since(m.last) < m.interval {
+		return false
+	}
+	m.last = time.Now()
+	return true
+}
+
+func (m *meter) snapshot() Snapshot {
+	m.Lock()
+	defer m.Unlock()
+	snapshot := Snapshot{Phase: m.phase, Name: m.name, Done: m.done, Total: m.total, Elapsed: time.Since(m.start)}
+	if seconds := snapshot.Elapsed.Seconds(); seconds > 0 {
+		snapshot.Rate = float64(m.done) / seconds
+	}
+	if snapshot.Rate > 0 && m.total > m.done {
+		snapshot.ETA = time.Duration(float64(m.total-m.done) / snapshot.Rate * float64(time.Second))
+	}
+	return snapshot
+}
@@ -0,0 +1,103 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingTask records the updates and the result of a task
+type recordingTask struct {
+	updates  []int64
+	finished bool
+	err      error
+}
+
+func (t *recordingTask) Update(done int64) {
+	t.updates = append(t.updates, done)
+}
+
+func (t *recordingTask) Finish(err error) {
+	t.finished = true
+	t.err = err
+}
+
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		done    int64
+		total   int64
+		percent float64
+		eta     bool
+	}{
+		{name: "half", done: 50, total: 100, percent: 50, eta: true},
+		{name: "done", done: 100, total: 100, percent: 100},
+		{name: "unknown total", done: 50, total: 0, percent: 0},
+		{name: "not started", done: 0, total: 100, percent: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMeter(PhaseUpload, "object.zip", test.total, 0)
+			m.start = time.Now().Add(-time.Second)
+			m.update(test.done)
+			snapshot := m.snapshot()
+			if snapshot.Phase != PhaseUpload || snapshot.Name != "object.zip" || snapshot.Done != test.done || snapshot.Total != test.total {
+				t.Errorf("unexpected snapshot %+v", snapshot)
+			}
+			if percent := snapshot.Percent(); percent != test.percent {
+				t.Errorf("expected %.1f%%, got %.1f%%", test.percent, percent)
+			}
+			if test.done > 0 && snapshot.Rate <= 0 {
+				t.Errorf("expected a rate, got %f", snapshot.Rate)
+			}
+			if (snapshot.ETA > 0) != test.eta {
+				t.Errorf("unexpected eta %v", snapshot.ETA)
+			}
+		})
+	}
+}
+
+func TestMeterInterval(t *testing.T) {
+	m := newMeter(PhaseChecksum, "object.zip", 100, time.Hour)
+	if m.update(10) {
+		t.Error("update within the interval should not be reported")
+	}
+	if m.snapshot().Done != 10 {
+		t.Error("update within the interval is not stored")
+	}
+	m.last = time.Now().Add(-2 * time.Hour)
+	if !m.update(20) {
+		t.Error("update after the interval should be reported")
+	}
+}
+
+func TestReader(t *testing.T) {
+	task := &recordingTask{}
+	data, err := io.ReadAll(NewReader(io.LimitReader(strings.NewReader(strings.Repeat("x", 100)), 100), task))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 100 {
+		t.Fatalf("expected 100 bytes, got %d", len(data))
+	}
+	if len(task.updates) == 0 || task.updates[len(task.updates)-1] != 100 {
+		t.Errorf("expected the last update to be 100, got %v", task.updates)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	tracker := NewTracker()
+	buf := &bytes.Buffer{}
+	task := Multi(Nop(), tracker, NewJSON(buf)).Start(PhaseDownload, "object.zip", 10)
+	task.Update(5)
+	task.Finish(nil)
+	snapshot, ok := tracker.Snapshot()
+	if !ok || snapshot.Done != 5 {
+		t.Errorf("tracker did not receive the task: %+v", snapshot)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Errorf("expected start and done event, got %q", buf.String())
+	}
+}
@@ -0,0 +1,84 @@
+package progress
+
+import "sync"
+
+// Tracker is a reporter which keeps the state of the latest task, e.g. for a status page
+type Tracker struct {
+	sync.Mutex
+	meter *meter
+	final *Snapshot // state of the latest task when it is finished
+}
+
+// NewTracker returns a reporter which remembers the latest task
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+func (t *Tracker) Start(phase Phase, name string, total int64) Task {
+	m := newMeter(phase, name, total, 0)
+	t.Lock()
+	defer t.Unlock()
+	t.meter = m
+	t.final = nil
+	return &trackerTask{tracker: t, meter: m}
+}
+
+// Snapshot returns the state of the latest task, false if no task was started
+func (t *Tracker) Snapshot() (Snapshot, bool) {
+	t.Lock()
+	defer t.Unlock()
+	switch {
+	case t.final != nil:
+		return *t.final, true
+	case t.meter != nil:
+		return t.meter.snapshot(), true
+	}
+	return Snapshot{}, false
+}
+
+type trackerTask struct {
+	tracker *Tracker
+	meter   *meter
+}
+
+func (t *trackerTask) Update(done int64) {
+	t.meter.update(done)
+}
+
+func (t *trackerTask) Finish(err error) {
+	snapshot := t.meter.snapshot()
+	t.tracker.Lock()
+	defer t.tracker.Unlock()
+	if t.tracker.meter == t.meter {
+		t.tracker.final = &snapshot
+	}
+}
+
+// Multi returns a reporter which forwards every task to all reporters
+func Multi(reporters ...Reporter) Reporter {
+	return multiReporter(reporters)
+}
+
+type multiReporter []Reporter
+
+func (m multiReporter) Start(phase Phase, name string, total int64) Task {
+	tasks := make(multiTask, 0, len(m))
+	for _, reporter := range m {
+		tasks = append(tasks, reporter.Start(phase, name, total))
+	}
+	return tasks
+}
+
+type multiTask []Task
+
+func (m multiTask) Update(done int64) {
+	for _, task := range m {
+		task.Update(done)
+	}
+}
+
+func (m multiTask) Finish(err error) {
+	for _, task := range m {
+		task.Finish(err)
+	}
+}
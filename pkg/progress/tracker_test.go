@@ -0,0 +1,31 @@
+package progress
+
+import (
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	if _, ok := tracker.Snapshot(); ok {
+		t.Fatal("tracker without task should have no snapshot")
+	}
+	first := tracker.Start(PhaseChecksum, "first.zip", 100)
+	first.Update(40)
+	if snapshot, ok := tracker.Snapshot(); !ok || snapshot.Name != "first.zip" || snapshot.Done != 40 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	first.Finish(nil)
+	first.Update(60)
+	if snapshot, _ := tracker.Snapshot(); snapshot.Done != 40 {
+		t.Errorf("finished task should keep its state, got %+v", snapshot)
+	}
+
+	// the latest task is tracked, an older task finishing later does not replace it
+	second := tracker.Start(PhaseUpload, "second.zip", 100)
+	third := tracker.Start(PhaseUpload, "third.zip", 100)
+	third.Update(10)
+	second.Finish(nil)
+	if snapshot, _ := tracker.Snapshot(); snapshot.Name != "third.zip" || snapshot.Done != 10 {
+		t.Errorf("expected third.zip, got %+v", snapshot)
+	}
+}
@@ -0,0 +1,129 @@
+// Package tracing contains the OpenTelemetry tracing of ona. Setup installs the exporter, the spans are created
+// with Tracer. The trace context is sent to the manager and the TUS server in the traceparent header, so an
+// ingest can be followed across the services.
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ocfl-archive/ona"
+
+const serviceName = "ona"
+
+// exporters
+const (
+	ExporterNone   = ""
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const ErrUnknownExporter = errors.Sentinel("unknown trace exporter")
+
+// Options select the exporter of the spans
+type Options struct {
+	// Exporter is otlp, stdout or file, no spans are exported if empty. The stdout exporter writes to stderr,
+	// because copy, stored, audit and report write their data to stdout.
+	Exporter string
+	// Endpoint is the URL of the OTLP/HTTP collector, e.g. http://localhost:4318. If empty, the
+	// OTEL_EXPORTER_OTLP_* environment variables or the default localhost:4318 are used.
+	Endpoint string
+	// File receives the spans as json for the file exporter, it is appended to
+	File string
+}
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Tracer returns the tracer of ona. Without Setup, its spans are not recorded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs the global tracer provider with the exporter of options. The returned function exports the
+// remaining spans and has to be called when the program ends.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	if options.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithHost(),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, errors.Wrap(err, "cannot create trace resource")
+	}
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	switch options.Exporter {
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if options.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		if options.File == "" {
+			return nil, errors.New("no file for the trace exporter")
+		}
+		var fp *os.File
+		if fp, err = os.OpenFile(options.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return nil, errors.Wrapf(err, "cannot open trace file '%s'", options.File)
+		}
+		file = fp
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(fp))
+	default:
+		return nil, errors.Wrapf(ErrUnknownExporter, "'%s'", options.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, errors.Wrapf(err, "cannot create %s trace exporter", options.Exporter)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span of ona with the attributes
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records err as status of span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
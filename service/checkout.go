@@ -0,0 +1,250 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	checksumImp "github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+const (
+	inventoryFile     = "inventory.json"
+	objectDeclaration = "0=ocfl_object_"
+)
+
+// Inventory contains the parts of an OCFL inventory needed to materialize a version
+type Inventory struct {
+	Id               string                      `json:"id"`
+	Type             string                      `json:"type"`
+	DigestAlgorithm  string                      `json:"digestAlgorithm"`
+	Head             string                      `json:"head"`
+	ContentDirectory string                      `json:"contentDirectory"`
+	Manifest         map[string][]string         `json:"manifest"`
+	Versions         map[string]InventoryVersion `json:"versions"`
+}
+
+type InventoryVersion struct {
+	Created string              `json:"created"`
+	Message string              `json:"message"`
+	State   map[string][]string `json:"state"`
+}
+
+// CheckoutVersion writes the logical state of the given version of the OCFL object contained in zipPath
+// to destination. If version is empty the head version is used. Every file is verified against the digest
+// of the inventory while it is written. The version is extracted into a temporary folder next to destination,
+// which replaces destination only if all files were verified, so a failed or cancelled checkout leaves no
+// partial folder behind. The checked out version is returned.
+//
+// gocfl loads objects from a storage root and needs the extension configuration of the archive to do so,
+// while copy only has a single object zip. The root inventory is read directly instead: it is the inventory
+// of the head version and, as required by OCFL, contains the state of all versions. It is verified against its
+// digest sidecar before it is used.
+func CheckoutVersion(ctx context.Context, zipPath string, version string, destination string, logger zLogger.ZLogger) (string, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot open zip file '%s'", zipPath)
+	}
+	defer zipReader.Close()
+
+	objectRoot, err := findObjectRoot(&zipReader.Reader)
+	if err != nil {
+		return "", err
+	}
+	inventory, err := readInventory(&zipReader.Reader, objectRoot)
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		version = inventory.Head
+	}
+	inventoryVersion, ok := inventory.Versions[version]
+	if !ok {
+		return "", errors.Errorf("version '%s' does not exist in object '%s', head is '%s'", version, inventory.Id, inventory.Head)
+	}
+
+	destination = filepath.Clean(destination)
+	tempDir, err := os.MkdirTemp(filepath.Dir(destination), "."+filepath.Base(destination)+"-")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create temporary folder")
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			logger.Error().Msgf("cannot remove temporary folder '%s': %v", tempDir, err)
+		}
+	}()
+
+	files := map[string]*zip.File{}
+	for _, file := range zipReader.File {
+		files[file.Name] = file
+	}
+	for digest, logicalPaths := range inventoryVersion.State {
+		contentPaths, ok := inventory.Manifest[digest]
+		if !ok || len(contentPaths) == 0 {
+			return "", errors.Errorf("digest '%s' of version '%s' not found in manifest", digest, version)
+		}
+		// all content paths of a digest have the same content, each of them has to be in the zip
+		var contentFile *zip.File
+		for _, contentPath := range contentPaths {
+			file, ok := files[path.Join(objectRoot, contentPath)]
+			if !ok {
+				return "", errors.Errorf("content file '%s' of digest '%s' not found in '%s'", contentPath, digest, zipPath)
+			}
+			if contentFile == nil {
+				contentFile = file
+			}
+		}
+		for _, logicalPath := range logicalPaths {
+			if !filepath.IsLocal(filepath.FromSlash(logicalPath)) {
+				return "", errors.Errorf("invalid logical path '%s'", logicalPath)
+			}
+			targetPath := filepath.Join(tempDir, filepath.FromSlash(logicalPath))
+			if err := extractFile(ctx, contentFile, targetPath, inventory.DigestAlgorithm, digest); err != nil {
+				return "", errors.Wrapf(err, "cannot extract '%s'", logicalPath)
+			}
+			logger.Debug().Msgf("extracted %s to %s", contentFile.Name, logicalPath)
+		}
+	}
+	if err := replaceFolder(tempDir, destination); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// replaceFolder moves source to destination. An existing destination is removed after source is in place.
+func replaceFolder(source string, destination string) error {
+	if err := os.Chmod(source, 0755); err != nil {
+		return errors.Wrapf(err, "cannot change mode of '%s'", source)
+	}
+	if _, err := os.Stat(destination); err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "cannot stat '%s'", destination)
+		}
+		if err := os.Rename(source, destination); err != nil {
+			return errors.Wrapf(err, "cannot move extracted version to '%s'", destination)
+		}
+		return nil
+	}
+	oldDestination := source + ".old"
+	if err := os.Rename(destination, oldDestination); err != nil {
+		return errors.Wrapf(err, "cannot move existing folder '%s'", destination)
+	}
+	if err := os.Rename(source, destination); err != nil {
+		if restoreErr := os.Rename(oldDestination, destination); restoreErr != nil {
+			return errors.Wrapf(restoreErr, "cannot restore '%s' from '%s'", destination, oldDestination)
+		}
+		return errors.Wrapf(err, "cannot move extracted version to '%s'", destination)
+	}
+	if err := os.RemoveAll(oldDestination); err != nil {
+		return errors.Wrapf(err, "cannot remove previous folder '%s'", oldDestination)
+	}
+	return nil
+}
+
+func findObjectRoot(zipReader *zip.Reader) (string, error) {
+	var roots []string
+	for _, file := range zipReader.File {
+		if strings.HasPrefix(path.Base(file.Name), objectDeclaration) {
+			roots = append(roots, path.Dir(file.Name))
+		}
+	}
+	switch len(roots) {
+	case 0:
+		return "", errors.New("no OCFL object found in zip file")
+	case 1:
+		if roots[0] == "." {
+			return "", nil
+		}
+		return roots[0], nil
+	default:
+		return "", errors.Errorf("zip file contains %d OCFL objects, only one is supported", len(roots))
+	}
+}
+
+// readInventory reads the root inventory and verifies it against its digest sidecar inventory.json.<algorithm>
+func readInventory(zipReader *zip.Reader, objectRoot string) (*Inventory, error) {
+	inventoryPath := path.Join(objectRoot, inventoryFile)
+	data, err := fs.ReadFile(zipReader, inventoryPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read inventory")
+	}
+	inventory := &Inventory{}
+	if err := json.Unmarshal(data, inventory); err != nil {
+		return nil, errors.Wrap(err, "cannot decode inventory")
+	}
+	sidecarPath := inventoryPath + "." + inventory.DigestAlgorithm
+	sidecar, err := fs.ReadFile(zipReader, sidecarPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read inventory digest '%s'", sidecarPath)
+	}
+	expected, _, _ := strings.Cut(strings.TrimSpace(string(sidecar)), " ")
+	csWriter, err := checksumImp.NewChecksumWriter([]checksumImp.DigestAlgorithm{checksumImp.DigestAlgorithm(inventory.DigestAlgorithm)}, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := csWriter.Write(data); err != nil {
+		return nil, err
+	}
+	if err := csWriter.Close(); err != nil {
+		return nil, err
+	}
+	checksums, err := csWriter.GetChecksums()
+	if err != nil {
+		return nil, err
+	}
+	if actual := checksums[checksumImp.DigestAlgorithm(inventory.DigestAlgorithm)]; !strings.EqualFold(actual, expected) {
+		return nil, errors.Errorf("inventory digest mismatch: expected %s, got %s", expected, actual)
+	}
+	return inventory, nil
+}
+
+func extractFile(ctx context.Context, contentFile *zip.File, targetPath string, digestAlgorithm string, digest string) error {
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	source, err := contentFile.Open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(targetPath)
+	if err != nil {
+		return err
+	}
+	csWriter, err := checksumImp.NewChecksumWriter(
+		[]checksumImp.DigestAlgorithm{checksumImp.DigestAlgorithm(digestAlgorithm)},
+		target,
+	)
+	if err != nil {
+		target.Close()
+		return err
+	}
+	if _, err := io.Copy(csWriter, NewContextReader(ctx, source)); err != nil {
+		csWriter.Close()
+		target.Close()
+		return err
+	}
+	if err := csWriter.Close(); err != nil {
+		target.Close()
+		return err
+	}
+	if err := target.Close(); err != nil {
+		return err
+	}
+	checksums, err := csWriter.GetChecksums()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(checksums[checksumImp.DigestAlgorithm(digestAlgorithm)], digest) {
+		return errors.Errorf("checksum mismatch: expected %s, got %s", digest, checksums[checksumImp.DigestAlgorithm(digestAlgorithm)])
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type testObject struct {
+	files           map[string]string // logical path -> content of v2, v1 contains a.txt only
+	tamperContent   bool              // content of a.txt in the zip does not match the inventory
+	tamperInventory bool              // inventory sidecar does not match the inventory
+	dedupPath       string            // second logical path of a.txt in v2
+	contentCopy     bool              // the manifest lists a second content path of a.txt
+	missingCopy     bool              // the second content path is not in the zip
+}
+
+func sha512Hex(data string) string {
+	digest := sha512.Sum512([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
+
+// writeTestObject writes a zip with an OCFL object with the versions v1 and v2
+func writeTestObject(t *testing.T, object testObject) string {
+	t.Helper()
+	inventory := Inventory{
+		Id:               "test:object",
+		Type:             "https://ocfl.io/1.1/spec/#inventory",
+		DigestAlgorithm:  "sha512",
+		Head:             "v2",
+		ContentDirectory: "content",
+		Manifest:         map[string][]string{},
+		Versions: map[string]InventoryVersion{
+			"v1": {State: map[string][]string{}},
+			"v2": {State: map[string][]string{}},
+		},
+	}
+	contents := map[string]string{}
+	for logicalPath, content := range object.files {
+		digest := sha512Hex(content)
+		contentPath := "v2/content/" + logicalPath
+		if logicalPath == "a.txt" {
+			contentPath = "v1/content/a.txt"
+			inventory.Versions["v1"].State[digest] = []string{logicalPath}
+			if object.tamperContent {
+				content = "tampered"
+			}
+		}
+		inventory.Manifest[digest] = []string{contentPath}
+		inventory.Versions["v2"].State[digest] = []string{logicalPath}
+		contents["object/"+contentPath] = content
+		if logicalPath != "a.txt" {
+			continue
+		}
+		if object.dedupPath != "" {
+			inventory.Versions["v2"].State[digest] = append(inventory.Versions["v2"].State[digest], object.dedupPath)
+		}
+		if object.contentCopy {
+			inventory.Manifest[digest] = append(inventory.Manifest[digest], "v2/content/copy.txt")
+			if !object.missingCopy {
+				contents["object/v2/content/copy.txt"] = content
+			}
+		}
+	}
+	inventoryData, err := json.Marshal(inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar := sha512Hex(string(inventoryData))
+	if object.tamperInventory {
+		sidecar = sha512Hex("other")
+	}
+	contents["object/0=ocfl_object_1.1"] = "ocfl_object_1.1\n"
+	contents["object/inventory.json"] = string(inventoryData)
+	contents["object/inventory.json.sha512"] = sidecar + " inventory.json\n"
+
+	zipPath := filepath.Join(t.TempDir(), "object.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipFile.Close()
+	zipWriter := zip.NewWriter(zipFile)
+	for name, content := range contents {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCheckoutVersion(t *testing.T) {
+	files := map[string]string{"a.txt": "first file\n", "dir/b.txt": "second file\n"}
+	tests := []struct {
+		name     string
+		object   testObject
+		version  string
+		expected string
+		files    map[string]string
+		fails    bool
+	}{
+		{name: "head", object: testObject{files: files}, expected: "v2", files: files},
+		{name: "v1", object: testObject{files: files}, version: "v1", expected: "v1", files: map[string]string{"a.txt": "first file\n"}},
+		{name: "deduplicated", object: testObject{files: files, dedupPath: "dir/copy.txt", contentCopy: true}, expected: "v2",
+			files: map[string]string{"a.txt": "first file\n", "dir/b.txt": "second file\n", "dir/copy.txt": "first file\n"}},
+		{name: "unknown version", object: testObject{files: files}, version: "v3", fails: true},
+		{name: "missing content path", object: testObject{files: files, contentCopy: true, missingCopy: true}, fails: true},
+		{name: "content digest mismatch", object: testObject{files: files, tamperContent: true}, fails: true},
+		{name: "inventory digest mismatch", object: testObject{files: files, tamperInventory: true}, fails: true},
+	}
+	logger := zerolog.Nop()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zipPath := writeTestObject(t, test.object)
+			parent := t.TempDir()
+			destination := filepath.Join(parent, "checkout")
+			if err := os.MkdirAll(destination, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(destination, "previous.txt"), []byte("previous"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			version, err := CheckoutVersion(context.Background(), zipPath, test.version, destination, &logger)
+			if test.fails {
+				if err == nil {
+					t.Fatal("CheckoutVersion succeeded, expected an error")
+				}
+				// the previous folder is left untouched
+				if tree := readTree(t, destination); len(tree) != 1 || tree["previous.txt"] != "previous" {
+					t.Errorf("destination was changed: %v", tree)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("CheckoutVersion failed: %v", err)
+				}
+				if version != test.expected {
+					t.Errorf("checked out version %s, expected %s", version, test.expected)
+				}
+				tree := readTree(t, destination)
+				if len(tree) != len(test.files) {
+					t.Errorf("checked out %v, expected %v", tree, test.files)
+				}
+				for logicalPath, content := range test.files {
+					if tree[logicalPath] != content {
+						t.Errorf("%s contains %q, expected %q", logicalPath, tree[logicalPath], content)
+					}
+				}
+			}
+			// no temporary folders are left behind
+			if entries, err := os.ReadDir(parent); err != nil || len(entries) != 1 {
+				t.Errorf("expected only the destination in %s, got %v", parent, entries)
+			}
+		})
+	}
+}
+
+func TestCheckoutVersionCancelled(t *testing.T) {
+	zipPath := writeTestObject(t, testObject{files: map[string]string{"a.txt": "first file\n"}})
+	destination := filepath.Join(t.TempDir(), "checkout")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger := zerolog.Nop()
+	if _, err := CheckoutVersion(ctx, zipPath, "", destination, &logger); err == nil {
+		t.Fatal("CheckoutVersion succeeded with a cancelled context")
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Errorf("destination %s exists after a cancelled checkout", destination)
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	checksumImp "github.com/je4/utils/v2/pkg/checksum"
+)
+
+const (
+	ChecksumType = checksumImp.DigestSHA512
+	// ChecksumSeparator separates checksum and file name in checksum files like <name>.zip.sha512
+	ChecksumSeparator = " *"
+)
+
+// ChecksumFileName returns the name of the checksum file of filePath, e.g. 123-345.zip.sha512
+func ChecksumFileName(filePath string) string {
+	return filePath + "." + string(ChecksumType)
+}
+
+// ReadChecksumFile reads the checksum of filePath from its checksum file, written by sha512sum or ona copy
+func ReadChecksumFile(filePath string) (string, error) {
+	data, err := os.ReadFile(ChecksumFileName(filePath))
+	if err != nil {
+		return "", err
+	}
+	checksum, _, _ := strings.Cut(strings.TrimSpace(string(data)), ChecksumSeparator)
+	checksum, _, _ = strings.Cut(checksum, " ")
+	if checksum == "" {
+		return "", errors.Errorf("checksum file '%s' is empty", ChecksumFileName(filePath))
+	}
+	return checksum, nil
+}
+
+// ChecksumFile calculates the sha512 checksum of the file at filePath
+func ChecksumFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return Checksum(file)
+}
+
+// Checksum calculates the sha512 checksum of all data read from reader
+func Checksum(reader io.Reader) (string, error) {
+	csWriter, err := checksumImp.NewChecksumWriter(
+		[]checksumImp.DigestAlgorithm{ChecksumType},
+		io.Discard,
+	)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(csWriter, reader); err != nil {
+		csWriter.Close()
+		return "", err
+	}
+	if err := csWriter.Close(); err != nil {
+		return "", errors.Wrap(err, "cannot close checksum writer")
+	}
+	checksums, err := csWriter.GetChecksums()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get checksum")
+	}
+	return checksums[ChecksumType], nil
+}
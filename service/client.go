@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+	"github.com/ocfl-archive/ona/pkg/metrics"
+	"github.com/ocfl-archive/ona/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultTimeout   = 60
+	defaultRetries   = 3
+	defaultRetryWait = 500
+)
+
+// Client is a reusable client for the DLZA manager API. It is safe for concurrent use and should be created
+// once and shared, so connections are pooled.
+type Client struct {
+	config     configuration.Config
+	httpClient *http.Client
+	tokens     *TokenSource
+	retries    int
+	retryWait  time.Duration
+}
+
+// NewClient creates a client from the configuration. Timeout is given in seconds, RetryWait in milliseconds.
+func NewClient(config configuration.Config) (*Client, error) {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	retries := config.Retries
+	if retries < 0 {
+		retries = 0
+	} else if retries == 0 {
+		retries = defaultRetries
+	}
+	retryWait := config.RetryWait
+	if retryWait <= 0 {
+		retryWait = defaultRetryWait
+	}
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := NewTokenSource(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create token source")
+	}
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{Transport: transport, Timeout: time.Duration(timeout) * time.Second},
+		tokens:     tokens,
+		retries:    retries,
+		retryWait:  time.Duration(retryWait) * time.Millisecond,
+	}, nil
+}
+
+// NewTransport creates the transport used for all connections to the manager and the TUS server. Every request
+// is traced and carries the trace context in the traceparent header.
+func NewTransport(config configuration.Config) (http.RoundTripper, error) {
+	tlsConfig, err := NewTLSConfig(config.TLS)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create TLS configuration")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 10
+	transport.TLSClientConfig = tlsConfig
+	return otelhttp.NewTransport(transport), nil
+}
+
+// HTTPClient returns the underlying http client
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// UploadHTTPClient returns a http client for the TUS server without request timeout. The Authorization
+// header is set on every request, so tokens are renewed during long uploads. All requests are bound to ctx,
+// so a cancelled context also stops a running chunk upload, and carry its correlation id.
+func (c *Client) UploadHTTPClient(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &authTransport{base: c.httpClient.Transport, client: c, ctx: ctx}}
+}
+
+// UploadAuthorization returns the Authorization header for the TUS server: the OIDC token if an issuer
+// is configured, the static key otherwise
+func (c *Client) UploadAuthorization(ctx context.Context) (string, error) {
+	if c.config.OIDC.Issuer != "" {
+		return c.tokens.Bearer(ctx)
+	}
+	return c.config.Key, nil
+}
+
+type authTransport struct {
+	base   http.RoundTripper
+	client *Client
+	ctx    context.Context
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authorization, err := t.client.UploadAuthorization(t.ctx)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(t.ctx)
+	req.Header.Set("Authorization", authorization)
+	if id := correlation.Id(t.ctx); id != "" {
+		req.Header.Set(correlation.Header, id)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Retries returns the number of retries of failed requests and the wait before the first retry, which is
+// doubled for every further retry
+func (c *Client) Retries() (int, time.Duration) {
+	return c.retries, c.retryWait
+}
+
+// Config returns the configuration of the client
+func (c *Client) Config() configuration.Config {
+	return c.config
+}
+
+// get sends a GET request to path and decodes the JSON response into result. Failed requests are retried
+// with exponential backoff.
+func (c *Client) get(ctx context.Context, path string, result any) error {
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(float64(c.retryWait) * math.Pow(2, float64(attempt-1)))
+			select {
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "request to %s cancelled after %d attempts: %v", path, attempt, err)
+			case <-time.After(wait):
+			}
+		}
+		var body []byte
+		body, err = c.do(ctx, http.MethodGet, path, nil)
+		if err == nil {
+			return json.Unmarshal(body, result)
+		}
+		var apiError *APIError
+		if !errors.As(err, &apiError) || !apiError.Retryable() {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends body as JSON to path and decodes the JSON response into result, if result is not nil
+func (c *Client) post(ctx context.Context, path string, body any, result any) error {
+	buf := bytes.Buffer{}
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return err
+	}
+	responseBody, err := c.do(ctx, http.MethodPost, path, &buf)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(responseBody, result)
+}
+
+// do executes a single request in a span named after the endpoint. The correlation id of ctx is sent along.
+// Failures are reported as *APIError.
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader) (responseBody []byte, err error) {
+	ctx, span := tracing.Start(ctx, "manager "+method+" "+endpoint(path), attribute.String("ona.manager.path", path))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	req, err := http.NewRequestWithContext(ctx, method, c.config.StatusUrl+path, body)
+	if err != nil {
+		return nil, err
+	}
+	bearer, err := c.tokens.Bearer(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create bearer token")
+	}
+	req.Header.Add("Authorization", bearer)
+	if id := correlation.Id(ctx); id != "" {
+		req.Header.Set(correlation.Header, id)
+	}
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.ManagerRequestDuration.WithLabelValues(endpoint(path), method, code).Observe(time.Since(start).Seconds())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &APIError{Method: method, URL: req.URL.String(), Err: err}
+	}
+	defer resp.Body.Close()
+	responseBody, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &APIError{Method: method, URL: req.URL.String(), Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(method, req.URL.String(), resp, responseBody)
+	}
+	return responseBody, nil
+}
+
+// endpoint returns the longest known endpoint path is starting with, so ids do not end up in metric labels
+func endpoint(path string) string {
+	result := ""
+	for _, e := range endpoints {
+		if strings.HasPrefix(path, e) && len(e) > len(result) {
+			result = e
+		}
+	}
+	if result == "" {
+		return "other"
+	}
+	return result
+}
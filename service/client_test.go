@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/ocfl-archive/ona/pkg/correlation"
+)
+
+// testServer answers the requests with the status codes in order, the last one is repeated. A status code of
+// 200 is answered with body.
+type testServer struct {
+	sync.Mutex
+	codes    []int
+	body     string
+	requests []*http.Request
+	times    []time.Time
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	code := s.codes[min(len(s.requests), len(s.codes)-1)]
+	s.requests = append(s.requests, r)
+	s.times = append(s.times, time.Now())
+	s.Unlock()
+	if code != http.StatusOK {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.Write([]byte(s.body))
+}
+
+// received returns the requests and the times they were received
+func (s *testServer) received() ([]*http.Request, []time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests, s.times
+}
+
+func newTestClient(t *testing.T, server *testServer, retries int, retryWait int) *Client {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	client, err := NewClient(configuration.Config{StatusUrl: httpServer.URL, JwtKey: "test", Retries: retries, RetryWait: retryWait})
+	if err != nil {
+		t.Fatalf("cannot create client: %v", err)
+	}
+	return client
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		retries  int
+		requests int
+		wantErr  error
+	}{
+		{name: "success", codes: []int{200}, retries: 3, requests: 1},
+		{name: "unavailable once", codes: []int{503, 200}, retries: 3, requests: 2},
+		{name: "server errors", codes: []int{500, 502, 504, 200}, retries: 3, requests: 4},
+		{name: "too many requests", codes: []int{429, 200}, retries: 3, requests: 2},
+		{name: "retries exhausted", codes: []int{503}, retries: 2, requests: 3, wantErr: ErrUnavailable},
+		{name: "retries disabled", codes: []int{503, 200}, retries: -1, requests: 1, wantErr: ErrUnavailable},
+		{name: "not found", codes: []int{404, 200}, retries: 3, requests: 1, wantErr: ErrNotFound},
+		{name: "unauthorized", codes: []int{401, 200}, retries: 3, requests: 1, wantErr: ErrUnauthorized},
+		{name: "conflict", codes: []int{409, 200}, retries: 3, requests: 1, wantErr: ErrConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &testServer{codes: test.codes, body: `{"Id":"1"}`}
+			client := newTestClient(t, server, test.retries, 1)
+			_, err := client.GetStatus(context.Background(), "1")
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+			if requests, _ := server.received(); len(requests) != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, len(requests))
+			}
+		})
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	server := &testServer{codes: []int{503, 503, 503, 200}, body: `{}`}
+	client := newTestClient(t, server, 3, 20)
+	if _, err := client.GetStatus(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	_, times := server.received()
+	if len(times) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(times))
+	}
+	// the wait is doubled for every retry
+	for attempt, minWait := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+		if wait := times[attempt+1].Sub(times[attempt]); wait < minWait {
+			t.Errorf("retry %d after %v, expected at least %v", attempt+1, wait, minWait)
+		}
+	}
+}
+
+func TestClientCancelledDuringBackoff(t *testing.T) {
+	server := &testServer{codes: []int{503}}
+	client := newTestClient(t, server, 5, 10000)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetStatus(ctx, "1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("cancelled request returned after %v", time.Since(start))
+	}
+	if requests, _ := server.received(); len(requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(requests))
+	}
+}
+
+func TestClientPostIsNotRetried(t *testing.T) {
+	server := &testServer{codes: []int{503, 200}, body: `{}`}
+	client := newTestClient(t, server, 3, 1)
+	if err := client.CreateObjectAndInstance(context.Background(), nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+	if requests, _ := server.received(); len(requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(requests))
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	server := &testServer{codes: []int{200}, body: `{}`}
+	client := newTestClient(t, server, 0, 1)
+	ctx := correlation.WithId(context.Background(), "test-id")
+	if _, err := client.GetStatus(ctx, "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	requests, _ := server.received()
+	request := requests[0]
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "Bearer ") {
+		t.Errorf("expected bearer token, got '%s'", request.Header.Get("Authorization"))
+	}
+	if id := request.Header.Get(correlation.Header); id != "test-id" {
+		t.Errorf("expected correlation id test-id, got '%s'", id)
+	}
+	if path := request.URL.EscapedPath(); path != "/status/a%2Fb" {
+		t.Errorf("expected escaped id, got %s", path)
+	}
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix = "ONA_"
+
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+
+	redacted = "******"
+)
+
+// legacySecretEnv is used for storage.secret if it is not set otherwise
+const legacySecretEnv = "SECRET"
+
+// legacyEnv are the environment variables used if no configuration file is given
+var legacyEnv = map[string]string{
+	"url":        "URL",
+	"key":        "KEY",
+	"jwt-key":    "JWT_KEY",
+	"status-url": "STATUS_URL",
+	"chunk-size": "CHUNK_SIZE",
+	"bar-pause":  "BAR_PAUSE",
+}
+
+// ConfigSources maps every configuration key (e.g. storage.secret) to the layer its value comes from
+type ConfigSources map[string]string
+
+// ConfigValue is a resolved configuration value for display
+type ConfigValue struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+type configField struct {
+	key    string
+	value  reflect.Value
+	secret bool
+	parent string
+}
+
+// LoadConfig resolves the configuration in layers with increasing precedence: defaults, configuration file
+// (or the legacy environment variables without a file), ONA_* environment variables and key=value overrides
+// given with --set. The keys are the yaml names joined by dots, e.g. storage.secret is set with
+// ONA_STORAGE_SECRET or --set storage.secret=... Finally the secret references are resolved.
+func LoadConfig(cfgFilePath string, profile string, overrides []string) (*configuration.Config, ConfigSources, error) {
+	configObj, sources, err := GetConfig(cfgFilePath, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyEnv(configObj, sources); err != nil {
+		return nil, nil, err
+	}
+	if err := applyOverrides(configObj, overrides, sources); err != nil {
+		return nil, nil, err
+	}
+	references, err := ResolveSecrets(configObj)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, reference := range references {
+		source := sources[key]
+		if source == "" {
+			source = sources[strings.SplitN(key, ".", 2)[0]]
+		}
+		sources[key] = source + " -> " + reference
+	}
+	return configObj, sources, nil
+}
+
+// EnvName returns the environment variable for a configuration key
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// ResolvedConfig returns all configuration values with their source. Secrets are redacted.
+func ResolvedConfig(configObj *configuration.Config, sources ConfigSources) []ConfigValue {
+	var values []ConfigValue
+	for _, field := range configFields(configObj, true) {
+		value := formatValue(field.value)
+		if field.secret && value != "" {
+			value = redacted
+		}
+		source := sources[field.key]
+		if source == "" {
+			source = sources[field.parent]
+		}
+		values = append(values, ConfigValue{Key: field.key, Value: value, Source: source})
+	}
+	return values
+}
+
+// recordSources sets source for all fields with a value which have no source yet
+func recordSources(configObj *configuration.Config, sources ConfigSources, source string) {
+	for _, field := range configFields(configObj, false) {
+		if _, ok := sources[field.key]; !ok && !field.value.IsZero() {
+			sources[field.key] = source
+		}
+	}
+}
+
+func applyLegacyEnv(configObj *configuration.Config, sources ConfigSources) error {
+	for _, field := range configFields(configObj, false) {
+		name, ok := legacyEnv[field.key]
+		if !ok {
+			continue
+		}
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		if err := setValue(field.value, raw); err != nil {
+			return errors.Wrapf(err, "invalid value of %s", name)
+		}
+		sources[field.key] = SourceEnv + " " + name
+	}
+	return nil
+}
+
+func applyEnv(configObj *configuration.Config, sources ConfigSources) error {
+	for _, field := range configFields(configObj, false) {
+		name := EnvName(field.key)
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(field.value, raw); err != nil {
+			return errors.Wrapf(err, "invalid value of %s", name)
+		}
+		sources[field.key] = SourceEnv + " " + name
+	}
+	return nil
+}
+
+func applyOverrides(configObj *configuration.Config, overrides []string, sources ConfigSources) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	fields := map[string]configField{}
+	for _, field := range configFields(configObj, false) {
+		fields[field.key] = field
+	}
+	for _, override := range overrides {
+		key, raw, ok := strings.Cut(override, "=")
+		if !ok {
+			return errors.Errorf("invalid override '%s', expected key=value", override)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		field, ok := fields[key]
+		if !ok {
+			return errors.Errorf("unknown configuration key '%s'", key)
+		}
+		if err := setValue(field.value, raw); err != nil {
+			return errors.Wrapf(err, "invalid value of %s", key)
+		}
+		sources[key] = SourceFlag
+	}
+	return nil
+}
+
+// configFields returns the settable fields of the configuration. With expand, slices of structs are
+// returned element by element, otherwise as one field which is set as yaml.
+func configFields(configObj *configuration.Config, expand bool) []configField {
+	var fields []configField
+	collectFields(reflect.ValueOf(configObj).Elem(), "", "", false, expand, &fields)
+	return fields
+}
+
+func collectFields(value reflect.Value, prefix string, parent string, secret bool, expand bool, fields *[]configField) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		structField := valueType.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(structField.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(structField.Name)
+		}
+		key := prefix + name
+		fieldSecret := secret || structField.Tag.Get("secret") == "true"
+		fieldValue := value.Field(i)
+		switch {
+		case fieldValue.Kind() == reflect.Struct:
+			collectFields(fieldValue, key+".", parent, fieldSecret, expand, fields)
+		case expand && fieldValue.Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < fieldValue.Len(); j++ {
+				collectFields(fieldValue.Index(j), fmt.Sprintf("%s.%d.", key, j), key, fieldSecret, expand, fields)
+			}
+		default:
+			*fields = append(*fields, configField{key: key, value: fieldValue, secret: fieldSecret, parent: parent})
+		}
+	}
+}
+
+func setValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+			for i, item := range items {
+				slice.Index(i).SetString(item)
+			}
+			value.Set(slice)
+			return nil
+		}
+		return yaml.Unmarshal([]byte(raw), value.Addr().Interface())
+	default:
+		return yaml.Unmarshal([]byte(raw), value.Addr().Interface())
+	}
+	return nil
+}
+
+func formatValue(value reflect.Value) string {
+	if value.IsZero() {
+		return ""
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String {
+			items := make([]string, value.Len())
+			for i := range items {
+				items[i] = value.Index(i).String()
+			}
+			return strings.Join(items, ",")
+		}
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(value.Interface())
+	}
+	data, err := yaml.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ConfigKeys returns all configuration keys, sorted
+func ConfigKeys() []string {
+	var keys []string
+	for _, field := range configFields(&configuration.Config{}, false) {
+		keys = append(keys, field.key)
+	}
+	sort.Strings(keys)
+	return keys
+}
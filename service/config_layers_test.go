@@ -0,0 +1,117 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	configObj := &configuration.Config{}
+	sources := ConfigSources{}
+	err := applyOverrides(configObj, []string{
+		"url=https://manager.example.com",
+		" Storage.Secret =s3cr=t",
+		"timeout=30",
+		"confirm=true",
+		"serve.hosts=[ona.example.com, ona.local]",
+	}, sources)
+	if err != nil {
+		t.Fatalf("applyOverrides failed: %v", err)
+	}
+	if configObj.Url != "https://manager.example.com" {
+		t.Errorf("url = %q", configObj.Url)
+	}
+	if configObj.Storage.Secret != "s3cr=t" {
+		t.Errorf("storage.secret = %q", configObj.Storage.Secret)
+	}
+	if configObj.Timeout != 30 {
+		t.Errorf("timeout = %d", configObj.Timeout)
+	}
+	if !configObj.Confirm {
+		t.Errorf("confirm = false")
+	}
+	if expected := []string{"ona.example.com", "ona.local"}; !reflect.DeepEqual(configObj.Serve.Hosts, expected) {
+		t.Errorf("serve.hosts = %v, expected %v", configObj.Serve.Hosts, expected)
+	}
+	for _, key := range []string{"url", "storage.secret", "timeout", "confirm", "serve.hosts"} {
+		if sources[key] != SourceFlag {
+			t.Errorf("source of %s = %q, expected %q", key, sources[key], SourceFlag)
+		}
+	}
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+	}{
+		{"no value", "url"},
+		{"unknown key", "unknown=1"},
+		{"invalid int", "timeout=soon"},
+		{"invalid bool", "confirm=maybe"},
+		{"struct", "storage=x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := applyOverrides(&configuration.Config{}, []string{test.override}, ConfigSources{}); err == nil {
+				t.Fatalf("applyOverrides(%q) succeeded, expected an error", test.override)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSources(t *testing.T) {
+	cfgFilePath := filepath.Join(t.TempDir(), "ona.yml")
+	if err := os.WriteFile(cfgFilePath, []byte("url: https://file.example.com\ntimeout: 10\nstorage:\n  name: archive\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRET", "legacy-secret")
+	t.Setenv(EnvName("timeout"), "20")
+	t.Setenv(EnvName("storage.name"), "")
+	os.Unsetenv(EnvName("storage.name"))
+
+	configObj, sources, err := LoadConfig(cfgFilePath, "", []string{"retries=5"})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	fileSource := SourceFile + " " + filepath.ToSlash(cfgFilePath)
+	tests := []struct {
+		key    string
+		value  any
+		actual any
+		source string
+	}{
+		{"url", "https://file.example.com", configObj.Url, fileSource},
+		{"storage.name", "archive", configObj.Storage.Name, fileSource},
+		{"timeout", 20, configObj.Timeout, SourceEnv + " ONA_TIMEOUT"},
+		{"retries", 5, configObj.Retries, SourceFlag},
+		{"storage.secret", "legacy-secret", configObj.Storage.Secret, SourceEnv + " " + legacySecretEnv},
+		{"log.level", "INFO", configObj.Log.Level, SourceDefault},
+		{"jwt-key", "", configObj.JwtKey, SourceDefault},
+	}
+	for _, test := range tests {
+		if test.actual != test.value {
+			t.Errorf("%s = %v, expected %v", test.key, test.actual, test.value)
+		}
+		if sources[test.key] != test.source {
+			t.Errorf("source of %s = %q, expected %q", test.key, sources[test.key], test.source)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"url":              "ONA_URL",
+		"storage.secret":   "ONA_STORAGE_SECRET",
+		"serve.retry-wait": "ONA_SERVE_RETRY_WAIT",
+	}
+	for key, expected := range tests {
+		if name := EnvName(key); name != expected {
+			t.Errorf("EnvName(%q) = %q, expected %q", key, name, expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"io"
+)
+
+// NewContextReader returns a reader which fails with the context error as soon as ctx is cancelled, so copies of
+// large files can be interrupted
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
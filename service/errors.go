@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+const (
+	ErrNotFound     = errors.Sentinel("not found")
+	ErrUnauthorized = errors.Sentinel("unauthorized")
+	ErrConflict     = errors.Sentinel("conflict")
+	ErrUnavailable  = errors.Sentinel("unavailable")
+	ErrPinMismatch  = errors.Sentinel("no certificate matches a pinned public key")
+	ErrNotSupported = errors.Sentinel("not supported by this manager")
+)
+
+const maxErrorBody = 1024
+
+// APIError describes a failed request to the manager. StatusCode is 0 if no response was received,
+// the cause is then available in Err.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+	RequestId  string
+	Err        error
+}
+
+func newAPIError(method string, url string, resp *http.Response, body []byte) *APIError {
+	apiError := &APIError{
+		Method:     method,
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get("X-Request-Id"),
+		Body:       strings.TrimSpace(string(body)),
+	}
+	errorBody := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(body, &errorBody) == nil {
+		if errorBody.Message != "" {
+			apiError.Body = errorBody.Message
+		} else if errorBody.Error != "" {
+			apiError.Body = errorBody.Error
+		}
+	}
+	if len(apiError.Body) > maxErrorBody {
+		apiError.Body = apiError.Body[:maxErrorBody] + "..."
+	}
+	return apiError
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s failed: %v", e.Method, e.URL, e.Err)
+	}
+	msg := fmt.Sprintf("%s %s has status code %d (%s)", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	if e.RequestId != "" {
+		msg += " [request id " + e.RequestId + "]"
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is(err, ErrNotFound) etc.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrNotSupported:
+		return e.StatusCode == http.StatusMethodNotAllowed || e.StatusCode == http.StatusNotImplemented
+	case ErrUnavailable:
+		return (e.StatusCode == 0 && !isTLSError(e.Err)) || e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// Retryable reports whether repeating the request may succeed. Failed TLS handshakes are not retried, an
+// untrusted certificate or a pin mismatch does not go away by waiting.
+func (e *APIError) Retryable() bool {
+	if e.StatusCode == 0 {
+		return !isTLSError(e.Err)
+	}
+	return e.StatusCode == http.StatusTooManyRequests ||
+		(e.StatusCode >= http.StatusInternalServerError && e.StatusCode != http.StatusNotImplemented)
+}
+
+// isTLSError reports whether err is caused by certificate verification, pinning or a TLS alert of the server
+func isTLSError(err error) bool {
+	var verificationError *tls.CertificateVerificationError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var invalidError x509.CertificateInvalidError
+	var alertError tls.AlertError
+	var recordHeaderError tls.RecordHeaderError
+	var opError *net.OpError
+	return errors.Is(err, ErrPinMismatch) ||
+		errors.As(err, &verificationError) ||
+		errors.As(err, &unknownAuthorityError) ||
+		errors.As(err, &hostnameError) ||
+		errors.As(err, &invalidError) ||
+		errors.As(err, &alertError) ||
+		errors.As(err, &recordHeaderError) ||
+		// alerts received from the server, e.g. a rejected client certificate
+		(errors.As(err, &opError) && opError.Op == "remote error")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "message", body: `{"message":"object missing","error":"Not Found"}`, want: "object missing"},
+		{name: "error", body: `{"error":"object missing"}`, want: "object missing"},
+		{name: "text", body: "  object missing\n", want: "object missing"},
+		{name: "empty json", body: `{}`, want: "{}"},
+		{name: "long", body: strings.Repeat("x", maxErrorBody+10), want: strings.Repeat("x", maxErrorBody) + "..."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{"X-Request-Id": {"r1"}}}
+			apiError := newAPIError(http.MethodGet, "http://manager/object/1", resp, []byte(test.body))
+			if apiError.Body != test.want {
+				t.Errorf("expected body '%s', got '%s'", test.want, apiError.Body)
+			}
+			if apiError.StatusCode != http.StatusNotFound || apiError.RequestId != "r1" {
+				t.Errorf("expected status code 404 and request id r1, got %d and %s", apiError.StatusCode, apiError.RequestId)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiError *APIError
+		want     string
+	}{
+		{
+			name:     "response",
+			apiError: &APIError{Method: "GET", URL: "http://manager/object/1", StatusCode: 404, Body: "object missing", RequestId: "r1"},
+			want:     "GET http://manager/object/1 has status code 404 (Not Found): object missing [request id r1]",
+		},
+		{
+			name:     "without body",
+			apiError: &APIError{Method: "POST", URL: "http://manager/status/", StatusCode: 500},
+			want:     "POST http://manager/status/ has status code 500 (Internal Server Error)",
+		},
+		{
+			name:     "no response",
+			apiError: &APIError{Method: "GET", URL: "http://manager/status/1", Err: errors.New("connection refused")},
+			want:     "GET http://manager/status/1 failed: connection refused",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if message := test.apiError.Error(); message != test.want {
+				t.Errorf("expected '%s', got '%s'", test.want, message)
+			}
+		})
+	}
+}
+
+func TestAPIErrorClassification(t *testing.T) {
+	connectionRefused := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		apiError  *APIError
+		sentinels []error
+		retryable bool
+	}{
+		{name: "bad request", apiError: &APIError{StatusCode: 400}},
+		{name: "unauthorized", apiError: &APIError{StatusCode: 401}, sentinels: []error{ErrUnauthorized}},
+		{name: "forbidden", apiError: &APIError{StatusCode: 403}, sentinels: []error{ErrUnauthorized}},
+		{name: "not found", apiError: &APIError{StatusCode: 404}, sentinels: []error{ErrNotFound}},
+		{name: "conflict", apiError: &APIError{StatusCode: 409}, sentinels: []error{ErrConflict}},
+		{name: "method not allowed", apiError: &APIError{StatusCode: 405}, sentinels: []error{ErrNotSupported}},
+		{name: "not implemented", apiError: &APIError{StatusCode: 501}, sentinels: []error{ErrNotSupported}},
+		{name: "too many requests", apiError: &APIError{StatusCode: 429}, retryable: true},
+		{name: "internal server error", apiError: &APIError{StatusCode: 500}, retryable: true},
+		{name: "bad gateway", apiError: &APIError{StatusCode: 502}, sentinels: []error{ErrUnavailable}, retryable: true},
+		{name: "service unavailable", apiError: &APIError{StatusCode: 503}, sentinels: []error{ErrUnavailable}, retryable: true},
+		{name: "gateway timeout", apiError: &APIError{StatusCode: 504}, sentinels: []error{ErrUnavailable}, retryable: true},
+		{name: "connection refused", apiError: &APIError{Err: connectionRefused}, sentinels: []error{ErrUnavailable, connectionRefused}, retryable: true},
+		{name: "pin mismatch", apiError: &APIError{Err: errors.Wrap(ErrPinMismatch, "tls")}, sentinels: []error{ErrPinMismatch}},
+		{name: "unknown authority", apiError: &APIError{Err: x509.UnknownAuthorityError{}}},
+	}
+	sentinels := []error{ErrNotFound, ErrUnauthorized, ErrConflict, ErrUnavailable, ErrPinMismatch, ErrNotSupported}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error = test.apiError
+			for _, sentinel := range append(sentinels, test.sentinels...) {
+				want := false
+				for _, expected := range test.sentinels {
+					want = want || expected == sentinel
+				}
+				if errors.Is(err, sentinel) != want {
+					t.Errorf("errors.Is(%v, %v) should be %v", err, sentinel, want)
+				}
+			}
+			if test.apiError.Retryable() != test.retryable {
+				t.Errorf("Retryable() should be %v", test.retryable)
+			}
+		})
+	}
+}
+
+func TestClientReturnsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "r1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"object missing"}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(configuration.Config{StatusUrl: server.URL, JwtKey: "test", Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetObjectBySignature(context.Background(), "alma1/2")
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiError.Method != http.MethodGet || apiError.URL != server.URL+"/object/signature/alma1%2F2" ||
+		apiError.StatusCode != http.StatusNotFound || apiError.Body != "object missing" || apiError.RequestId != "r1" {
+		t.Errorf("unexpected error %#v", apiError)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
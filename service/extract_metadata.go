@@ -25,7 +25,7 @@ type Gocfl struct {
 	logger           zLogger.ZLogger
 }
 
-func (g *Gocfl) ExtractMetadata(storageRootPath string) (models.Object, error) {
+func (g *Gocfl) ExtractMetadata(ctx context.Context, storageRootPath string) (models.Object, error) {
 
 	ocflFS, err := g.fsFactory.Get(storageRootPath, true)
 	if err != nil {
@@ -37,8 +37,7 @@ func (g *Gocfl) ExtractMetadata(storageRootPath string) (models.Object, error) {
 		}
 	}()
 
-	ctx := ocfl.NewContextValidation(context.TODO())
-	storageRoot, err := ocfl.LoadStorageRoot(ctx, ocflFS, g.extensionFactory, g.logger, archiveerror.NewFactory("ona"), "")
+	storageRoot, err := ocfl.LoadStorageRoot(ocfl.NewContextValidation(ctx), ocflFS, g.extensionFactory, g.logger, archiveerror.NewFactory("ona"), "")
 	if err != nil {
 		return models.Object{}, err
 	}
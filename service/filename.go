@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// Signatures are mapped to file names with the pairtree character cleaning
+// (https://datatracker.ietf.org/doc/html/draft-kunze-pairtree-01#section-3). Characters which are not visible
+// ASCII and the characters "*+,<=>?\^| are hex encoded as ^hh, then / is replaced by =, : by + and . by ,
+// The encoding is reversible and the encoded signature never contains a dot, so everything after the first
+// dot of a file name is its extension.
+
+const (
+	encodeMarker    = '^'
+	encodeSeparator = "."
+)
+
+// legacyFileName matches the file names of objects ingested and copied before the encoding, every character
+// except -_.a-zA-Z0-9 of the signature was replaced by _
+var legacyFileName = regexp.MustCompile(`^[-_.a-zA-Z0-9]+$`)
+
+// EncodeSignature returns the file name safe form of signature
+func EncodeSignature(signature string) string {
+	builder := strings.Builder{}
+	for _, b := range []byte(signature) {
+		switch {
+		case b < 0x21 || b > 0x7e || strings.IndexByte(`"*+,<=>?\^|`, b) >= 0:
+			builder.WriteString(fmt.Sprintf("%c%02x", encodeMarker, b))
+		case b == '/':
+			builder.WriteByte('=')
+		case b == ':':
+			builder.WriteByte('+')
+		case b == '.':
+			builder.WriteByte(',')
+		default:
+			builder.WriteByte(b)
+		}
+	}
+	return builder.String()
+}
+
+// DecodeSignature reverses EncodeSignature. Names which EncodeSignature cannot produce, e.g. with a dot,
+// a colon or an upper case escape sequence, are rejected.
+func DecodeSignature(encoded string) (string, error) {
+	decoded := make([]byte, 0, len(encoded))
+	for i := 0; i < len(encoded); i++ {
+		b := encoded[i]
+		switch b {
+		case encodeMarker:
+			if i+2 >= len(encoded) {
+				return "", errors.Errorf("incomplete escape sequence at position %d of '%s'", i, encoded)
+			}
+			value, err := strconv.ParseUint(encoded[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid escape sequence at position %d of '%s'", i, encoded)
+			}
+			decoded = append(decoded, byte(value))
+			i += 2
+		case '=':
+			decoded = append(decoded, '/')
+		case '+':
+			decoded = append(decoded, ':')
+		case ',':
+			decoded = append(decoded, '.')
+		default:
+			decoded = append(decoded, b)
+		}
+	}
+	if EncodeSignature(string(decoded)) != encoded {
+		return "", errors.Errorf("'%s' is not an encoded signature", encoded)
+	}
+	return string(decoded), nil
+}
+
+// SignatureFileName returns the file name for signature with the given extension (e.g. ".zip")
+func SignatureFileName(signature string, extension string) string {
+	return EncodeSignature(signature) + extension
+}
+
+// SignatureFromFileName returns the signature of a file name created by SignatureFileName. The directory and
+// all extensions (e.g. ".zip.sha512") are removed.
+func SignatureFromFileName(fileName string) (string, error) {
+	encoded, _, _ := strings.Cut(filepath.Base(fileName), encodeSeparator)
+	return DecodeSignature(encoded)
+}
+
+// SignatureFromLegacyFileName returns the signature of a file name from before the encoding. The directory and
+// the last extension are removed. The _ of the name may stand for any replaced character, so the signature has
+// to be confirmed by the archive.
+func SignatureFromLegacyFileName(fileName string) (string, error) {
+	base := filepath.Base(fileName)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if !legacyFileName.MatchString(name) {
+		return "", errors.Errorf("'%s' is not a legacy file name", fileName)
+	}
+	return name, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import "testing"
+
+func TestEncodeSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		encoded   string
+	}{
+		{"alma1234", "alma1234"},
+		{"alma:1234/5.6", "alma+1234=5,6"},
+		{"a b", "a^20b"},
+		{"a+b=c,d^e", "a^2bb^3dc^2cd^5ee"},
+		{`x"*<>?\|`, "x^22^2a^3c^3e^3f^5c^7c"},
+		{"ä", "^c3^a4"},
+		{"under_score-dash", "under_score-dash"},
+	}
+	for _, test := range tests {
+		t.Run(test.signature, func(t *testing.T) {
+			encoded := EncodeSignature(test.signature)
+			if encoded != test.encoded {
+				t.Fatalf("EncodeSignature(%q) = %q, expected %q", test.signature, encoded, test.encoded)
+			}
+			decoded, err := DecodeSignature(encoded)
+			if err != nil {
+				t.Fatalf("DecodeSignature(%q) failed: %v", encoded, err)
+			}
+			if decoded != test.signature {
+				t.Fatalf("DecodeSignature(%q) = %q, expected %q", encoded, decoded, test.signature)
+			}
+		})
+	}
+}
+
+func TestDecodeSignatureInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		"alma^2",       // incomplete escape sequence
+		"alma^zz",      // no hex digits
+		"alma^2B",      // upper case escape sequence
+		"alma^41",      // escaped character which is not encoded
+		"alma:1234",    // colon is encoded as +
+		"alma/1234",    // slash is encoded as =
+		"alma.1234",    // dot is encoded as ,
+		"alma 1234",    // space is encoded as ^20
+		"alma\x7f1234", // control character
+		"almaä1234",    // non ASCII character
+	} {
+		if signature, err := DecodeSignature(encoded); err == nil {
+			t.Errorf("DecodeSignature(%q) = %q, expected an error", encoded, signature)
+		}
+	}
+}
+
+func TestSignatureFromFileName(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		signature string
+	}{
+		{"alma+1234=5,6.zip", "alma:1234/5.6"},
+		{"alma+1234=5,6.zip.sha512", "alma:1234/5.6"},
+		{"/mnt/a.b/alma+1.zip", "alma:1"},
+		{"relative/dir.d/alma1234", "alma1234"},
+	}
+	for _, test := range tests {
+		signature, err := SignatureFromFileName(test.fileName)
+		if err != nil {
+			t.Errorf("SignatureFromFileName(%q) failed: %v", test.fileName, err)
+			continue
+		}
+		if signature != test.signature {
+			t.Errorf("SignatureFromFileName(%q) = %q, expected %q", test.fileName, signature, test.signature)
+		}
+	}
+	if signature, err := SignatureFromFileName("/mnt/alma 1.zip"); err == nil {
+		t.Errorf("SignatureFromFileName of a name which is not encoded = %q, expected an error", signature)
+	}
+}
+
+func TestSignatureFromLegacyFileName(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		signature string
+	}{
+		{"alma1234.zip", "alma1234"},
+		{"/mnt/a.b/alma_1234_5.6.zip", "alma_1234_5.6"},
+		{"test_file-ub", "test_file-ub"},
+	}
+	for _, test := range tests {
+		signature, err := SignatureFromLegacyFileName(test.fileName)
+		if err != nil {
+			t.Errorf("SignatureFromLegacyFileName(%q) failed: %v", test.fileName, err)
+			continue
+		}
+		if signature != test.signature {
+			t.Errorf("SignatureFromLegacyFileName(%q) = %q, expected %q", test.fileName, signature, test.signature)
+		}
+	}
+	for _, fileName := range []string{"alma+1234.zip", "alma 1.zip", ".zip"} {
+		if signature, err := SignatureFromLegacyFileName(fileName); err == nil {
+			t.Errorf("SignatureFromLegacyFileName(%q) = %q, expected an error", fileName, signature)
+		}
+	}
+}
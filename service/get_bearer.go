@@ -1,25 +1,183 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"crypto"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/ocfl-archive/ona/configuration"
-	"time"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	defaultTokenTTL = 300
+	// tokens are renewed if they expire within this margin
+	tokenRefreshMargin = 30 * time.Second
 )
 
-func GetBearer(config configuration.Config) (string, error) {
+// TokenSource provides the tokens used to authenticate at the manager. Tokens are either signed locally
+// or taken from the OIDC credential cache. They are cached and renewed shortly before they expire.
+// It is safe for concurrent use.
+type TokenSource struct {
+	method      jwt.SigningMethod
+	key         any
+	claims      jwt.RegisteredClaims
+	keyId       string
+	ttl         time.Duration
+	oidc        *OIDC
+	lock        sync.Mutex
+	token       string
+	expires     time.Time
+	credentials *Credentials
+	refreshing  chan struct{} // closed when the running refresh of the OIDC credentials is done
+}
 
-	token := jwt.New(jwt.SigningMethodHS256)
+// NewTokenSource creates a token source from the configuration. If an OIDC issuer is configured the
+// tokens of ona login are used. Without a private key the token is signed with HS256 and JwtKey.
+func NewTokenSource(config configuration.Config) (*TokenSource, error) {
+	if config.OIDC.Issuer != "" {
+		oidc, err := NewOIDC(config)
+		if err != nil {
+			return nil, err
+		}
+		return &TokenSource{oidc: oidc}, nil
+	}
+	auth := config.Auth
+	ttl := auth.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	tokenSource := &TokenSource{
+		keyId: auth.KeyId,
+		ttl:   time.Duration(ttl) * time.Second,
+		claims: jwt.RegisteredClaims{
+			Issuer:   auth.Issuer,
+			Subject:  auth.Subject,
+			Audience: auth.Audience,
+		},
+	}
+	if tokenSource.claims.Subject == "" {
+		if currentUser, err := user.Current(); err == nil {
+			tokenSource.claims.Subject = currentUser.Username
+		}
+	}
+	if auth.PrivateKey == "" {
+		if auth.Algorithm != "" && auth.Algorithm != jwt.SigningMethodHS256.Alg() {
+			return nil, errors.Errorf("algorithm %s needs a private key", auth.Algorithm)
+		}
+		tokenSource.method = jwt.SigningMethodHS256
+		tokenSource.key = []byte(config.JwtKey)
+		return tokenSource, nil
+	}
+	tokenSource.method = jwt.GetSigningMethod(auth.Algorithm)
+	if tokenSource.method == nil {
+		return nil, errors.Errorf("unknown signing algorithm '%s'", auth.Algorithm)
+	}
+	key, err := loadPrivateKey(auth.PrivateKey, auth.KeystorePassword, tokenSource.method)
+	if err != nil {
+		return nil, err
+	}
+	tokenSource.key = key
+	return tokenSource, nil
+}
 
-	claims := token.Claims.(jwt.MapClaims)
+// Bearer returns the value of the Authorization header
+func (t *TokenSource) Bearer(ctx context.Context) (string, error) {
+	if t.oidc != nil {
+		return t.oidcBearer(ctx)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	if t.token != "" && now.Add(tokenRefreshMargin).Before(t.expires) {
+		return "Bearer " + t.token, nil
+	}
+	claims := t.claims
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(t.ttl))
+	token := jwt.NewWithClaims(t.method, claims)
+	if t.keyId != "" {
+		token.Header["kid"] = t.keyId
+	}
+	tokenStr, err := token.SignedString(t.key)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot sign token")
+	}
+	t.token = tokenStr
+	t.expires = claims.ExpiresAt.Time
+	return "Bearer " + tokenStr, nil
+}
 
-	claims["exp"] = time.Now().Add(time.Minute * 100).Unix()
-	secret := []byte(config.JwtKey)
-	tokenStr, err := token.SignedString(secret)
+// oidcBearer returns the cached OIDC token. The credentials are refreshed without holding the lock, so a slow
+// issuer does not block the other requests; concurrent callers wait for the running refresh.
+func (t *TokenSource) oidcBearer(ctx context.Context) (string, error) {
+	for {
+		t.lock.Lock()
+		credentials, refreshing := t.credentials, t.refreshing
+		if credentials.Valid(tokenRefreshMargin) {
+			t.lock.Unlock()
+			return credentials.TokenType + " " + credentials.AccessToken, nil
+		}
+		if refreshing == nil {
+			break
+		}
+		t.lock.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	refreshing := make(chan struct{})
+	t.refreshing = refreshing
+	t.lock.Unlock()
 
+	credentials, err := t.oidc.Credentials(ctx)
+	t.lock.Lock()
+	if err == nil {
+		t.credentials = credentials
+	}
+	t.refreshing = nil
+	close(refreshing)
+	t.lock.Unlock()
 	if err != nil {
-		fmt.Println(err.Error())
 		return "", err
 	}
-	return "Bearer " + tokenStr, nil
+	return credentials.TokenType + " " + credentials.AccessToken, nil
+}
+
+// loadPrivateKey reads a PEM encoded key or a PKCS#12 keystore (.p12, .pfx) protected by password
+func loadPrivateKey(keyPath string, password string, method jwt.SigningMethod) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read private key '%s'", keyPath)
+	}
+	var key crypto.PrivateKey
+	switch strings.ToLower(filepath.Ext(keyPath)) {
+	case ".p12", ".pfx":
+		key, _, _, err = pkcs12.DecodeChain(data, password)
+	default:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			key, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+		case *jwt.SigningMethodECDSA:
+			key, err = jwt.ParseECPrivateKeyFromPEM(data)
+		case *jwt.SigningMethodEd25519:
+			key, err = jwt.ParseEdPrivateKeyFromPEM(data)
+		default:
+			return nil, errors.Errorf("algorithm %s cannot be used with a private key", method.Alg())
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load private key '%s'", keyPath)
+	}
+	return key, nil
 }
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ocfl-archive/ona/configuration"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// writeTestKey writes key as PEM block of blockType or, for a .p12 file, as PKCS#12 keystore with password
+func writeTestKey(t *testing.T, dir string, name string, key crypto.Signer, blockType string, password string) string {
+	t.Helper()
+	keyPath := filepath.Join(dir, name)
+	var data []byte
+	var err error
+	switch {
+	case strings.HasSuffix(name, ".p12"):
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "operator"},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = pkcs12.Modern.Encode(key, cert, nil, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case blockType == "RSA PRIVATE KEY":
+		data = pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))})
+	case blockType == "EC PRIVATE KEY":
+		der, err := x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	}
+	if err = os.WriteFile(keyPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath
+}
+
+func TestTokenSourceKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPKCS1 := writeTestKey(t, dir, "rsa.pem", rsaKey, "RSA PRIVATE KEY", "")
+	rsaPKCS8 := writeTestKey(t, dir, "rsa8.pem", rsaKey, "PRIVATE KEY", "")
+	ecPEM := writeTestKey(t, dir, "ec.pem", ecKey, "EC PRIVATE KEY", "")
+	edPEM := writeTestKey(t, dir, "ed.pem", edKey, "PRIVATE KEY", "")
+	rsaP12 := writeTestKey(t, dir, "rsa.p12", rsaKey, "", "secret")
+	ecP12 := writeTestKey(t, dir, "ec.p12", ecKey, "", "secret")
+
+	tests := []struct {
+		name      string
+		algorithm string
+		keyPath   string
+		password  string
+		publicKey crypto.PublicKey
+		wantErr   bool
+	}{
+		{name: "RS256 PKCS#1", algorithm: "RS256", keyPath: rsaPKCS1, publicKey: rsaKey.Public()},
+		{name: "PS256 PKCS#8", algorithm: "PS256", keyPath: rsaPKCS8, publicKey: rsaKey.Public()},
+		{name: "ES256", algorithm: "ES256", keyPath: ecPEM, publicKey: ecKey.Public()},
+		{name: "EdDSA", algorithm: "EdDSA", keyPath: edPEM, publicKey: edKey.Public()},
+		{name: "RS256 PKCS#12", algorithm: "RS256", keyPath: rsaP12, password: "secret", publicKey: rsaKey.Public()},
+		{name: "ES256 PKCS#12", algorithm: "ES256", keyPath: ecP12, password: "secret", publicKey: ecKey.Public()},
+		{name: "wrong keystore password", algorithm: "ES256", keyPath: ecP12, password: "wrong", wantErr: true},
+		{name: "key does not match algorithm", algorithm: "RS256", keyPath: ecPEM, wantErr: true},
+		{name: "HS256 with private key", algorithm: "HS256", keyPath: ecPEM, wantErr: true},
+		{name: "unknown algorithm", algorithm: "XS256", keyPath: ecPEM, wantErr: true},
+		{name: "missing key file", algorithm: "ES256", keyPath: filepath.Join(dir, "missing.pem"), wantErr: true},
+		{name: "algorithm without key", algorithm: "ES256", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := NewTokenSource(configuration.Config{Auth: configuration.Auth{
+				Algorithm:        test.algorithm,
+				PrivateKey:       test.keyPath,
+				KeystorePassword: test.password,
+			}})
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			bearer, err := tokens.Bearer(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := jwt.Parse(strings.TrimPrefix(bearer, "Bearer "), func(token *jwt.Token) (any, error) {
+				return test.publicKey, nil
+			}, jwt.WithValidMethods([]string{test.algorithm}))
+			if err != nil || !token.Valid {
+				t.Errorf("token cannot be verified with the public key: %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenSourceClaims(t *testing.T) {
+	tokens, err := NewTokenSource(configuration.Config{JwtKey: "shared-secret", Auth: configuration.Auth{
+		Issuer:   "ona-test",
+		Subject:  "operator",
+		Audience: []string{"dlza-manager"},
+		KeyId:    "key-1",
+		TokenTTL: 120,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer, err := tokens.Bearer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimPrefix(bearer, "Bearer "), claims, func(token *jwt.Token) (any, error) {
+		return []byte("shared-secret"), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer("ona-test"), jwt.WithSubject("operator"), jwt.WithAudience("dlza-manager"))
+	if err != nil {
+		t.Fatalf("invalid token: %v", err)
+	}
+	if token.Header["kid"] != "key-1" {
+		t.Errorf("expected kid key-1, got %v", token.Header["kid"])
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != 120*time.Second {
+		t.Errorf("expected a token valid for 120s, got %v", ttl)
+	}
+	if claims.NotBefore == nil {
+		t.Error("nbf is not set")
+	}
+}
+
+func TestTokenSourceCaching(t *testing.T) {
+	tokens, err := NewTokenSource(configuration.Config{JwtKey: "shared-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := tokens.Bearer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tokens.Bearer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("a valid token was not reused")
+	}
+	// a token expiring within the refresh margin is renewed
+	tokens.expires = time.Now().Add(tokenRefreshMargin / 2)
+	if _, err := tokens.Bearer(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !tokens.expires.After(time.Now().Add(tokenRefreshMargin)) {
+		t.Errorf("token expiring at %v was not renewed", tokens.expires)
+	}
+}
+
+func TestTokenSourceOIDCRefresh(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	var issuerURL string
+	mux.HandleFunc("GET "+wellKnownConfiguration, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuerURL, "token_endpoint": issuerURL + "/token"})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "client-token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	issuer := httptest.NewServer(mux)
+	defer issuer.Close()
+	issuerURL = issuer.URL
+	tokens, err := NewTokenSource(configuration.Config{OIDC: configuration.OIDC{
+		Issuer:          issuer.URL,
+		ClientId:        "ona",
+		ClientSecret:    "client-secret",
+		Flow:            OIDCFlowClientCredentials,
+		CredentialsFile: filepath.Join(t.TempDir(), credentialsFileName),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// callers wait for the running refresh instead of requesting tokens on their own
+	wg := sync.WaitGroup{}
+	bearers := make([]string, 8)
+	errs := make([]error, len(bearers))
+	for i := range bearers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bearers[i], errs[i] = tokens.Bearer(context.Background())
+		}()
+	}
+	// a caller whose context ends does not wait for the refresh
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := tokens.Bearer(ctx); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+	close(release)
+	wg.Wait()
+	for i, bearer := range bearers {
+		if errs[i] != nil || bearer != "Bearer client-token" {
+			t.Errorf("expected Bearer client-token, got '%s' (%v)", bearer, errs[i])
+		}
+	}
+	if count := requests.Load(); count != 1 {
+		t.Errorf("expected 1 token request, got %d", count)
+	}
+}
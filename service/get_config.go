@@ -1,61 +1,125 @@
 package service
 
 import (
+	"emperror.dev/errors"
 	"github.com/je4/filesystem/v3/pkg/vfsrw"
 	"github.com/je4/utils/v2/pkg/config"
 	"github.com/jinzhu/configor"
 	"github.com/ocfl-archive/ona/configuration"
-	"log"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 )
 
-func GetConfig(cfgFilePathRaw string) *configuration.Config {
+const profileEnv = "ONA_PROFILE"
+
+// GetConfig loads the configuration file. If the file contains profiles, the given profile is used, ONA_PROFILE
+// or the default profile of the file if it is empty. Without a file the legacy environment variables are used.
+// The source of every value is returned.
+func GetConfig(cfgFilePathRaw string, profile string) (*configuration.Config, ConfigSources, error) {
 
 	configObj := configuration.Config{}
+	sources := ConfigSources{}
 	if cfgFilePathRaw != "" {
 		cfgFilePath := filepath.ToSlash(filepath.Clean(cfgFilePathRaw))
-		err := configor.Load(&configObj, cfgFilePath)
+		if _, err := os.Stat(cfgFilePath); err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot read configuration file '%s'", cfgFilePath)
+		}
+		profiles := configuration.Profiles{}
+		err := configor.Load(&profiles, cfgFilePath)
 		if err != nil {
-			log.Fatal(err)
+			return nil, nil, errors.Wrapf(err, "cannot load configuration file '%s'", cfgFilePath)
 		}
-	} else {
-		configObj = configuration.Config{
-			Url:       os.Getenv("URL"),
-			Key:       os.Getenv("KEY"),
-			JwtKey:    os.Getenv("JWT_KEY"),
-			StatusUrl: os.Getenv("STATUS_URL"),
+		if len(profiles.Profiles) > 0 {
+			if profile == "" {
+				profile = os.Getenv(profileEnv)
+			}
+			if profile == "" {
+				profile = profiles.DefaultProfile
+			}
+			if profile == "" {
+				return nil, nil, errors.Errorf("no profile selected, use --profile or %s, available profiles: %v", profileEnv, profileNames(profiles))
+			}
+			profileConfig, ok := profiles.Profiles[profile]
+			if !ok {
+				return nil, nil, errors.Errorf("profile '%s' not found in '%s', available profiles: %v", profile, cfgFilePath, profileNames(profiles))
+			}
+			configObj = profileConfig
+			configObj.Profile = profile
+		} else {
+			err = configor.Load(&configObj, cfgFilePath)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "cannot load configuration file '%s'", cfgFilePath)
+			}
 		}
-		chunkSize, _ := strconv.Atoi(os.Getenv("CHUNK_SIZE"))
-		configObj.ChunkSize = int64(chunkSize)
-		configObj.BarPause, _ = strconv.Atoi(os.Getenv("BAR_PAUSE"))
+		recordSources(&configObj, sources, SourceFile+" "+cfgFilePath)
+	} else if err := applyLegacyEnv(&configObj, sources); err != nil {
+		return nil, nil, err
 	}
 	if configObj.Log.Level == "" {
 		configObj.Log.Level = "INFO"
 	}
 	if configObj.Storage.Secret == "" {
-		configObj.Storage.Secret = os.Getenv("SECRET")
+		if secret := os.Getenv(legacySecretEnv); secret != "" {
+			configObj.Storage.Secret = secret
+			sources["storage.secret"] = SourceEnv + " " + legacySecretEnv
+		}
+	}
+	for _, field := range configFields(&configObj, false) {
+		if _, ok := sources[field.key]; !ok {
+			sources[field.key] = SourceDefault
+		}
 	}
-	return &configObj
+	return &configObj, sources, nil
+}
+
+func profileNames(profiles configuration.Profiles) []string {
+	names := make([]string, 0, len(profiles.Profiles))
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LoadVfsConfig(cfg configuration.Config) (vfsrw.Config, error) {
-	vfsTemp := vfsrw.VFS{
-		Type: cfg.Storage.Type,
-		Name: cfg.Storage.Name,
+	vfsMap := make(map[string]*vfsrw.VFS)
+	vfsMap[cfg.Storage.Name] = loadVfs(cfg.Storage)
+	for _, target := range cfg.Targets {
+		if _, ok := vfsMap[target.Name]; ok {
+			return nil, errors.Errorf("storage name '%s' is used more than once", target.Name)
+		}
+		vfsMap[target.Name] = loadVfs(target)
+	}
+	return vfsMap, nil
+}
+
+func loadVfs(storage configuration.Storage) *vfsrw.VFS {
+	if storage.Type == "sftp" {
+		return &vfsrw.VFS{
+			Type: storage.Type,
+			Name: storage.Name,
+			SFTP: &vfsrw.SFTP{
+				Address:    storage.Url,
+				User:       storage.User,
+				Password:   config.EnvString(storage.Secret),
+				PrivateKey: storage.PrivateKey,
+				KnownHosts: storage.KnownHosts,
+				BaseDir:    storage.BaseDir,
+			},
+		}
+	}
+	return &vfsrw.VFS{
+		Type: storage.Type,
+		Name: storage.Name,
 		S3: &vfsrw.S3{
-			AccessKeyID:     config.EnvString(cfg.Storage.Key),
-			SecretAccessKey: config.EnvString(cfg.Storage.Secret),
-			Endpoint:        config.EnvString(cfg.Storage.Url),
+			AccessKeyID:     config.EnvString(storage.Key),
+			SecretAccessKey: config.EnvString(storage.Secret),
+			Endpoint:        config.EnvString(storage.Url),
 			Region:          "us-east-1",
 			UseSSL:          true,
-			Debug:           cfg.Storage.Debug,
-			CAPEM:           cfg.Storage.CAPEM,
+			Debug:           storage.Debug,
+			CAPEM:           storage.CAPEM,
 		},
 	}
-
-	vfsMap := make(map[string]*vfsrw.VFS)
-	vfsMap[cfg.Storage.Name] = &vfsTemp
-	return vfsMap, nil
 }
@@ -1,20 +1,18 @@
 package service
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 
-	"emperror.dev/errors"
-	"github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
 	pb "github.com/ocfl-archive/dlza-manager/dlzamanagerproto"
-	"github.com/ocfl-archive/ona/configuration"
 	"github.com/ocfl-archive/ona/models"
 )
 
+// Routes of the manager. All path segments, signatures included, are escaped. storage-location/partition and
+// object-instance-check/last are optional, stored, report and audit show the partition id and an unknown last
+// check if the manager answers not found or not supported. The manager cannot list the objects of a
+// collection or search objects by metadata.
 const (
 	aliasAndSize            = "/storage-location/collection/"
 	status                  = "/status/"
@@ -26,211 +24,85 @@ const (
 	ResultingQuality        = "resulting-quality/"
 	NeededQuality           = "needed-quality/"
 	createObjectAndInstance = "/object/create/"
+	locationByPartition     = "/storage-location/partition/"
+	lastInstanceCheck       = "/object-instance-check/last/"
 )
 
-func GetObjectInstancesBySignatureAndLocationsPathName(signature string, config configuration.Config) (*pb.ObjectInstance, error) {
+// endpoints are the label values of the manager request metrics
+var endpoints = []string{aliasAndSize, status, storageInfo, objectInstanceInfo, objectInstanceRawCheck,
+	object, objectSignature, createObjectAndInstance, locationByPartition, lastInstanceCheck}
+
+func (c *Client) GetObjectInstancesBySignatureAndLocationsPathName(ctx context.Context, signature string) (*pb.ObjectInstance, error) {
 	objectInstance := &pb.ObjectInstance{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+objectInstanceInfo+signature+"/"+config.Storage.Name, nil)
-	if err != nil {
-		return objectInstance, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return objectInstance, err
-	}
-	err = json.Unmarshal(body, &objectInstance)
-	if err != nil {
-		return objectInstance, err
-	}
-	return objectInstance, nil
+	err := c.get(ctx, objectInstanceInfo+url.PathEscape(signature)+"/"+url.PathEscape(c.config.Storage.Name), objectInstance)
+	return objectInstance, err
 }
-func CheckRawObjectInstanceByObjectId(objectId string, config configuration.Config) (*pb.ObjectInstance, error) {
+
+func (c *Client) CheckRawObjectInstanceByObjectId(ctx context.Context, objectId string) (*pb.ObjectInstance, error) {
 	objectInstance := &pb.ObjectInstance{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+objectInstanceRawCheck+objectId, nil)
-	if err != nil {
-		return objectInstance, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return objectInstance, err
-	}
-	err = json.Unmarshal(body, &objectInstance)
-	if err != nil {
-		return objectInstance, err
-	}
-	return objectInstance, nil
+	err := c.get(ctx, objectInstanceRawCheck+url.PathEscape(objectId), objectInstance)
+	return objectInstance, err
 }
 
-func GetObjectBySignature(signature string, config configuration.Config) (*pb.Object, error) {
+func (c *Client) GetObjectBySignature(ctx context.Context, signature string) (*pb.Object, error) {
 	object := &pb.Object{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+objectSignature+signature, nil)
-	if err != nil {
-		return object, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return object, err
-	}
-	err = json.Unmarshal(body, &object)
-	if err != nil {
-		return object, err
-	}
-	return object, nil
+	err := c.get(ctx, objectSignature+url.PathEscape(signature), object)
+	return object, err
 }
 
-func GetStorageLocationsStatusForCollectionAlias(alias string, size int64, signature string, head string, config configuration.Config) (string, error) {
+func (c *Client) GetStorageLocationsStatusForCollectionAlias(ctx context.Context, alias string, size int64, signature string, head string) (string, error) {
 	var status pb.Id
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s%s/%d/%s/%s", config.StatusUrl, aliasAndSize, alias, size, signature, head), nil)
-	if err != nil {
-		return "error", err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return "error", err
-	}
-	err = json.Unmarshal(body, &status)
-	if err != nil {
+	if err := c.get(ctx, fmt.Sprintf("%s%s/%d/%s/%s", aliasAndSize, url.PathEscape(alias), size, url.PathEscape(signature), url.PathEscape(head)), &status); err != nil {
 		return "error", err
 	}
 	return status.Id, nil
 }
 
-func GetQualityForObject(id string, resultingOrNeeded string, config configuration.Config) (*pb.SizeAndId, error) {
+func (c *Client) GetQualityForObject(ctx context.Context, id string, resultingOrNeeded string) (*pb.SizeAndId, error) {
 	quality := &pb.SizeAndId{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+object+resultingOrNeeded+id, nil)
-	if err != nil {
-		return quality, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return quality, err
-	}
-	err = json.Unmarshal(body, &quality)
-	if err != nil {
-		return quality, err
-	}
-	return quality, nil
+	err := c.get(ctx, object+resultingOrNeeded+url.PathEscape(id), quality)
+	return quality, err
 }
 
-func GetStatus(id string, config configuration.Config) (models.ArchivingStatus, error) {
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+status+id, nil)
-	if err != nil {
-		return models.ArchivingStatus{}, err
-	}
-	body, err := sendRequest(req, config)
+func (c *Client) GetStatus(ctx context.Context, id string) (models.ArchivingStatus, error) {
 	archivingStatus := models.ArchivingStatus{}
-	if err != nil {
-		return archivingStatus, err
-	}
-	err = json.Unmarshal(body, &archivingStatus)
-	if err != nil {
-		return archivingStatus, err
-	}
-	return archivingStatus, nil
+	err := c.get(ctx, status+url.PathEscape(id), &archivingStatus)
+	return archivingStatus, err
 }
 
-func GetObjectInstancesByName(name string, config configuration.Config) (*dlzamanagerproto.ObjectInstances, error) {
-	objectInstances := &dlzamanagerproto.ObjectInstances{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+storageInfo+name, nil)
-	if err != nil {
-		return objectInstances, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return objectInstances, err
-	}
-	err = json.Unmarshal(body, &objectInstances)
-	if err != nil {
-		return objectInstances, err
-	}
-	return objectInstances, nil
+func (c *Client) GetObjectInstancesByName(ctx context.Context, name string) (*pb.ObjectInstances, error) {
+	objectInstances := &pb.ObjectInstances{}
+	err := c.get(ctx, storageInfo+url.PathEscape(name), objectInstances)
+	return objectInstances, err
 }
 
-func GetObjectsByChecksum(checksum string, config configuration.Config) (*dlzamanagerproto.Objects, error) {
-	objects := &dlzamanagerproto.Objects{}
-	req, err := http.NewRequest(http.MethodGet, config.StatusUrl+object+checksum, nil)
-	if err != nil {
-		return objects, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return objects, err
-	}
-	err = json.Unmarshal(body, &objects)
-	if err != nil {
-		return objects, err
-	}
-	return objects, nil
+// GetStorageLocationByPartitionId returns the storage location of a partition, e.g. of an object instance
+func (c *Client) GetStorageLocationByPartitionId(ctx context.Context, partitionId string) (models.StorageLocation, error) {
+	location := models.StorageLocation{}
+	err := c.get(ctx, locationByPartition+url.PathEscape(partitionId), &location)
+	return location, err
 }
 
-func CreateObjectAndInstance(objectAndInstance *pb.ObjectAndFile, config configuration.Config) error {
-	buf := bytes.Buffer{}
-	err := json.NewEncoder(&buf).Encode(objectAndInstance)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest(http.MethodPost, config.StatusUrl+createObjectAndInstance, &buf)
-	if err != nil {
-		return err
-	}
-	_, err = sendRequest(req, config)
-	if err != nil {
-		return err
-	}
-	return nil
+// GetLastObjectInstanceCheck returns the latest fixity check of an object instance. ErrNotFound stands for a
+// missing check as well as for a manager without the route.
+func (c *Client) GetLastObjectInstanceCheck(ctx context.Context, objectInstanceId string) (models.ObjectInstanceCheck, error) {
+	check := models.ObjectInstanceCheck{}
+	err := c.get(ctx, lastInstanceCheck+url.PathEscape(objectInstanceId), &check)
+	return check, err
 }
 
-func CreateStatus(statusObj models.ArchivingStatus, config configuration.Config) (models.ArchivingStatus, error) {
-	archivingStatus := models.ArchivingStatus{}
-	buf := bytes.Buffer{}
-	err := json.NewEncoder(&buf).Encode(statusObj)
-	if err != nil {
-		return archivingStatus, err
-	}
-	req, err := http.NewRequest(http.MethodPost, config.StatusUrl+status, &buf)
-	if err != nil {
-		return archivingStatus, err
-	}
-	body, err := sendRequest(req, config)
-	if err != nil {
-		return archivingStatus, err
-	}
-	err = json.Unmarshal(body, &archivingStatus)
-	if err != nil {
-		return archivingStatus, err
-	}
-	return archivingStatus, nil
+func (c *Client) GetObjectsByChecksum(ctx context.Context, checksum string) (*pb.Objects, error) {
+	objects := &pb.Objects{}
+	err := c.get(ctx, object+url.PathEscape(checksum), objects)
+	return objects, err
 }
 
-func sendRequest(req *http.Request, config configuration.Config) ([]byte, error) {
-	defaultTransport := http.DefaultTransport.(*http.Transport)
-
-	// Create new Transport that ignores self-signed SSL
-	customTransport := &http.Transport{
-		Proxy:                 defaultTransport.Proxy,
-		DialContext:           defaultTransport.DialContext,
-		MaxIdleConns:          defaultTransport.MaxIdleConns,
-		IdleConnTimeout:       defaultTransport.IdleConnTimeout,
-		ExpectContinueTimeout: defaultTransport.ExpectContinueTimeout,
-		TLSHandshakeTimeout:   defaultTransport.TLSHandshakeTimeout,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: customTransport}
-
-	bearer, err := GetBearer(config)
-	req.Header.Add("Authorization", bearer)
-
-	resp, err := client.Do(req)
-	if err == nil {
-		if resp.StatusCode != 200 {
-			return nil, errors.New("Status has status code: " + string(resp.StatusCode))
-		}
-	} else {
-		return nil, err
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	return body, nil
+func (c *Client) CreateObjectAndInstance(ctx context.Context, objectAndInstance *pb.ObjectAndFile) error {
+	return c.post(ctx, createObjectAndInstance, objectAndInstance, nil)
+}
+
+func (c *Client) CreateStatus(ctx context.Context, statusObj models.ArchivingStatus) (models.ArchivingStatus, error) {
+	archivingStatus := models.ArchivingStatus{}
+	err := c.post(ctx, status, statusObj, &archivingStatus)
+	return archivingStatus, err
 }
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+const (
+	OIDCFlowDevice            = "device"
+	OIDCFlowClientCredentials = "client-credentials"
+
+	wellKnownConfiguration = "/.well-known/openid-configuration"
+	grantTypeDeviceCode    = "urn:ietf:params:oauth:grant-type:device_code"
+	defaultDeviceInterval  = 5
+	credentialsFileName    = "credentials.json"
+)
+
+var ErrNotLoggedIn = errors.New("not logged in, please run ona login")
+
+// Credentials are the cached tokens of an OIDC login
+type Credentials struct {
+	Issuer       string    `json:"issuer"`
+	ClientId     string    `json:"client_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Valid reports whether the access token can be used for at least margin
+func (c *Credentials) Valid(margin time.Duration) bool {
+	return c != nil && c.AccessToken != "" && time.Now().Add(margin).Before(c.Expiry)
+}
+
+type oidcProvider struct {
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// OIDC runs OAuth2/OIDC flows against the issuer of the configuration
+type OIDC struct {
+	config     configuration.OIDC
+	httpClient *http.Client
+}
+
+func NewOIDC(config configuration.Config) (*OIDC, error) {
+	if config.OIDC.Issuer == "" {
+		return nil, errors.New("no oidc issuer configured")
+	}
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDC{config: config.OIDC, httpClient: &http.Client{Transport: transport, Timeout: time.Minute}}, nil
+}
+
+// Login runs the configured flow and stores the resulting credentials in the credential cache.
+// Instructions for the device flow are written to out.
+func (o *OIDC) Login(ctx context.Context, out io.Writer) (*Credentials, error) {
+	var credentials *Credentials
+	var err error
+	switch o.config.Flow {
+	case "", OIDCFlowDevice:
+		credentials, err = o.deviceLogin(ctx, out)
+	case OIDCFlowClientCredentials:
+		credentials, err = o.clientCredentialsLogin(ctx)
+	default:
+		return nil, errors.Errorf("unknown oidc flow '%s'", o.config.Flow)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := o.saveCredentials(credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// Logout removes the cached credentials of the issuer
+func (o *OIDC) Logout() error {
+	cache, err := o.loadCache()
+	if err != nil {
+		return err
+	}
+	if _, ok := cache[o.cacheKey()]; !ok {
+		return ErrNotLoggedIn
+	}
+	delete(cache, o.cacheKey())
+	return o.writeCache(cache)
+}
+
+// Credentials returns valid cached credentials. Expired access tokens are refreshed, with the client
+// credentials flow new tokens are requested without a previous login.
+func (o *OIDC) Credentials(ctx context.Context) (*Credentials, error) {
+	cache, err := o.loadCache()
+	if err != nil {
+		return nil, err
+	}
+	credentials, ok := cache[o.cacheKey()]
+	if ok && credentials.Valid(tokenRefreshMargin) {
+		return credentials, nil
+	}
+	if ok && credentials.RefreshToken != "" {
+		refreshed, err := o.refresh(ctx, credentials.RefreshToken)
+		if err == nil {
+			if refreshed.RefreshToken == "" {
+				refreshed.RefreshToken = credentials.RefreshToken
+			}
+			return refreshed, o.saveCredentials(refreshed)
+		}
+		if o.config.Flow != OIDCFlowClientCredentials {
+			return nil, errors.Wrap(err, "cannot refresh token, please run ona login")
+		}
+	}
+	if o.config.Flow == OIDCFlowClientCredentials {
+		return o.Login(ctx, io.Discard)
+	}
+	return nil, ErrNotLoggedIn
+}
+
+func (o *OIDC) deviceLogin(ctx context.Context, out io.Writer) (*Credentials, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if provider.DeviceAuthorizationEndpoint == "" {
+		return nil, errors.Errorf("issuer %s does not support the device flow", o.config.Issuer)
+	}
+	form := url.Values{"client_id": {o.config.ClientId}, "scope": {strings.Join(o.config.Scopes, " ")}}
+	device := &deviceAuthorizationResponse{}
+	if err := o.postForm(ctx, provider.DeviceAuthorizationEndpoint, form, device); err != nil {
+		return nil, errors.Wrap(err, "cannot start device authorization")
+	}
+	if device.VerificationUriComplete != "" {
+		fmt.Fprintf(out, "Open %s in a browser to log in\n", device.VerificationUriComplete)
+	} else {
+		fmt.Fprintf(out, "Open %s in a browser and enter the code %s to log in\n", device.VerificationUri, device.UserCode)
+	}
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	form = url.Values{"grant_type": {grantTypeDeviceCode}, "device_code": {device.DeviceCode}, "client_id": {o.config.ClientId}}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		if device.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, errors.New("device code expired, please run ona login again")
+		}
+		token := &tokenResponse{}
+		err := o.postForm(ctx, provider.TokenEndpoint, form, token)
+		switch token.Error {
+		case "":
+			if err != nil {
+				return nil, err
+			}
+			return o.newCredentials(token), nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += defaultDeviceInterval * time.Second
+		default:
+			return nil, errors.Errorf("login failed: %s %s", token.Error, token.ErrorDescription)
+		}
+	}
+}
+
+func (o *OIDC) clientCredentialsLogin(ctx context.Context) (*Credentials, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {strings.Join(o.config.Scopes, " ")}}
+	token := &tokenResponse{}
+	if err := o.postForm(ctx, provider.TokenEndpoint, form, token); err != nil {
+		return nil, errors.Wrap(err, "cannot get token")
+	}
+	return o.newCredentials(token), nil
+}
+
+func (o *OIDC) refresh(ctx context.Context, refreshToken string) (*Credentials, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {o.config.ClientId}}
+	token := &tokenResponse{}
+	if err := o.postForm(ctx, provider.TokenEndpoint, form, token); err != nil {
+		return nil, errors.Wrap(err, "cannot refresh token")
+	}
+	return o.newCredentials(token), nil
+}
+
+func (o *OIDC) newCredentials(token *tokenResponse) *Credentials {
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return &Credentials{
+		Issuer:       o.config.Issuer,
+		ClientId:     o.config.ClientId,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    tokenType,
+		Expiry:       time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+}
+
+func (o *OIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(o.config.Issuer, "/")+wellKnownConfiguration, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot reach issuer %s", o.config.Issuer)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("cannot get openid configuration of %s: status code %d", o.config.Issuer, resp.StatusCode)
+	}
+	provider := &oidcProvider{}
+	if err := json.NewDecoder(resp.Body).Decode(provider); err != nil {
+		return nil, errors.Wrap(err, "cannot decode openid configuration")
+	}
+	return provider, nil
+}
+
+// postForm posts form to endpoint and decodes the JSON response into result, also for error responses
+func (o *OIDC) postForm(ctx context.Context, endpoint string, form url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientId), url.QueryEscape(o.config.ClientSecret))
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return errors.Wrapf(err, "cannot decode response of %s with status code %d", endpoint, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s has status code %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+func (o *OIDC) cacheKey() string {
+	return o.config.Issuer + " " + o.config.ClientId
+}
+
+// credentialsPath returns the credential cache, <user config dir>/ona/credentials.json by default
+func (o *OIDC) credentialsPath() (string, error) {
+	if o.config.CredentialsFile != "" {
+		return o.config.CredentialsFile, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot find user config directory")
+	}
+	return filepath.Join(configDir, "ona", credentialsFileName), nil
+}
+
+func (o *OIDC) loadCache() (map[string]*Credentials, error) {
+	cache := map[string]*Credentials{}
+	cachePath, err := o.credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, errors.Wrapf(err, "cannot read credential cache '%s'", cachePath)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode credential cache '%s'", cachePath)
+	}
+	return cache, nil
+}
+
+func (o *OIDC) saveCredentials(credentials *Credentials) error {
+	cache, err := o.loadCache()
+	if err != nil {
+		return err
+	}
+	cache[o.cacheKey()] = credentials
+	return o.writeCache(cache)
+}
+
+// writeCache writes the credential cache readable for the current user only
+func (o *OIDC) writeCache(cache map[string]*Credentials) error {
+	cachePath, err := o.credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return errors.Wrapf(err, "cannot create directory for credential cache '%s'", cachePath)
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := cachePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return errors.Wrapf(err, "cannot write credential cache '%s'", cachePath)
+	}
+	if err := os.Chmod(tempPath, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, cachePath)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+// testIssuer is a stand-in OIDC issuer supporting the device, client credentials and refresh token grants
+type testIssuer struct {
+	sync.Mutex
+	*httptest.Server
+	t            *testing.T
+	pending      int    // authorization_pending responses before the device code is granted
+	deviceError  string // error returned instead of a token in the device flow
+	clientSecret string
+	grants       []string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{t: t, clientSecret: "client-secret"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+wellKnownConfiguration, func(w http.ResponseWriter, r *http.Request) {
+		issuer.writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                        issuer.URL,
+			"token_endpoint":                issuer.URL + "/token",
+			"device_authorization_endpoint": issuer.URL + "/device",
+		})
+	})
+	mux.HandleFunc("POST /device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "ona" || r.FormValue("scope") != "openid archive" {
+			issuer.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		issuer.writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": issuer.URL + "/activate",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("POST /token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *testIssuer) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		i.t.Error(err)
+	}
+}
+
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	i.Lock()
+	defer i.Unlock()
+	grantType := r.FormValue("grant_type")
+	i.grants = append(i.grants, grantType)
+	switch grantType {
+	case grantTypeDeviceCode:
+		if r.FormValue("device_code") != "device-code" {
+			i.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if i.pending > 0 {
+			i.pending--
+			i.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+			return
+		}
+		if i.deviceError != "" {
+			i.writeJSON(w, http.StatusBadRequest, map[string]string{"error": i.deviceError, "error_description": "denied by user"})
+			return
+		}
+		i.writeJSON(w, http.StatusOK, map[string]any{"access_token": "device-token", "refresh_token": "refresh-token", "token_type": "bearer", "expires_in": 3600})
+	case "client_credentials":
+		if clientId, secret, ok := r.BasicAuth(); !ok || clientId != "ona" || secret != i.clientSecret {
+			i.writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		i.writeJSON(w, http.StatusOK, map[string]any{"access_token": "client-token", "token_type": "Bearer", "expires_in": 3600})
+	case "refresh_token":
+		if r.FormValue("refresh_token") != "refresh-token" {
+			i.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		i.writeJSON(w, http.StatusOK, map[string]any{"access_token": "refreshed-token", "expires_in": 3600})
+	default:
+		i.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	}
+}
+
+func (i *testIssuer) grantTypes() []string {
+	i.Lock()
+	defer i.Unlock()
+	return append([]string{}, i.grants...)
+}
+
+func newTestOIDC(t *testing.T, issuer *testIssuer, flow string, clientSecret string) *OIDC {
+	t.Helper()
+	oidc, err := NewOIDC(configuration.Config{OIDC: configuration.OIDC{
+		Issuer:          issuer.URL,
+		ClientId:        "ona",
+		ClientSecret:    clientSecret,
+		Scopes:          []string{"openid", "archive"},
+		Flow:            flow,
+		CredentialsFile: filepath.Join(t.TempDir(), "ona", credentialsFileName),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidc
+}
+
+func TestOIDCDeviceFlow(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.pending = 1
+	oidc := newTestOIDC(t, issuer, "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := oidc.Credentials(ctx); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("expected ErrNotLoggedIn before the login, got %v", err)
+	}
+	out := &bytes.Buffer{}
+	credentials, err := oidc.Login(ctx, out)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if !strings.Contains(out.String(), issuer.URL+"/activate") || !strings.Contains(out.String(), "ABCD-EFGH") {
+		t.Errorf("instructions do not contain the verification uri and the user code: %s", out.String())
+	}
+	if credentials.AccessToken != "device-token" || credentials.TokenType != "Bearer" || !credentials.Valid(time.Minute) {
+		t.Errorf("unexpected credentials %+v", credentials)
+	}
+	if grants := issuer.grantTypes(); len(grants) != 2 {
+		t.Errorf("expected a pending and a successful token request, got %v", grants)
+	}
+
+	info, err := os.Stat(oidc.config.CredentialsFile)
+	if err != nil {
+		t.Fatalf("credential cache not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("credential cache has mode %v, expected 0600", info.Mode().Perm())
+	}
+	// cached credentials are used without a request to the issuer
+	cached, err := oidc.Credentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.AccessToken != "device-token" {
+		t.Errorf("cached access token is %s", cached.AccessToken)
+	}
+	if grants := issuer.grantTypes(); len(grants) != 2 {
+		t.Errorf("cached credentials were requested again: %v", grants)
+	}
+
+	if err := oidc.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oidc.Credentials(ctx); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("expected ErrNotLoggedIn after the logout, got %v", err)
+	}
+	if err := oidc.Logout(); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("expected ErrNotLoggedIn for a second logout, got %v", err)
+	}
+}
+
+func TestOIDCDeviceFlowDenied(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.deviceError = "access_denied"
+	oidc := newTestOIDC(t, issuer, OIDCFlowDevice, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := oidc.Login(ctx, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("expected access_denied, got %v", err)
+	}
+	if _, err := os.Stat(oidc.config.CredentialsFile); !os.IsNotExist(err) {
+		t.Errorf("credential cache written after a failed login")
+	}
+}
+
+func TestOIDCClientCredentials(t *testing.T) {
+	issuer := newTestIssuer(t)
+	oidc := newTestOIDC(t, issuer, OIDCFlowClientCredentials, "client-secret")
+	ctx := context.Background()
+
+	// no login is needed with the client credentials flow
+	credentials, err := oidc.Credentials(ctx)
+	if err != nil {
+		t.Fatalf("Credentials failed: %v", err)
+	}
+	if credentials.AccessToken != "client-token" {
+		t.Errorf("access token is %s, expected client-token", credentials.AccessToken)
+	}
+	if _, err := oidc.Credentials(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if grants := issuer.grantTypes(); len(grants) != 1 || grants[0] != "client_credentials" {
+		t.Errorf("expected one client credentials request, got %v", grants)
+	}
+
+	invalid := newTestOIDC(t, issuer, OIDCFlowClientCredentials, "wrong-secret")
+	if _, err := invalid.Login(ctx, &bytes.Buffer{}); err == nil {
+		t.Error("Login with a wrong client secret succeeded")
+	}
+}
+
+func TestOIDCRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	oidc := newTestOIDC(t, issuer, OIDCFlowDevice, "")
+	expired := &Credentials{
+		Issuer:       issuer.URL,
+		ClientId:     "ona",
+		AccessToken:  "expired-token",
+		RefreshToken: "refresh-token",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+	if err := oidc.saveCredentials(expired); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := oidc.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("Credentials failed: %v", err)
+	}
+	if credentials.AccessToken != "refreshed-token" {
+		t.Errorf("access token is %s, expected refreshed-token", credentials.AccessToken)
+	}
+	// the issuer did not rotate the refresh token, so the previous one is kept
+	if credentials.RefreshToken != "refresh-token" {
+		t.Errorf("refresh token is %s, expected refresh-token", credentials.RefreshToken)
+	}
+	cache, err := oidc.loadCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache[oidc.cacheKey()].AccessToken != "refreshed-token" {
+		t.Errorf("refreshed credentials not cached")
+	}
+}
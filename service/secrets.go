@@ -0,0 +1,163 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+	"github.com/tobischo/gokeepasslib/v3"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	secretFile    = "file:"
+	secretEnv     = "env:"
+	secretKeyring = "keyring:"
+	secretKeePass = "keepass:"
+
+	// KeePassPasswordEnv and KeePassKeyFileEnv unlock the KeePass databases of keepass: references
+	KeePassPasswordEnv = "ONA_KEEPASS_PASSWORD"
+	KeePassKeyFileEnv  = "ONA_KEEPASS_KEYFILE"
+)
+
+// IsSecretReference reports whether value refers to a secret instead of containing it
+func IsSecretReference(value string) bool {
+	for _, prefix := range []string{secretFile, secretEnv, secretKeyring, secretKeePass} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecrets replaces the references in all secret fields of the configuration by the secrets:
+//
+//	file:/run/secrets/jwt          content of the file without trailing newline
+//	env:NAME                       environment variable NAME
+//	keyring:service/user           system keyring (Keychain, Windows Credential Manager, Secret Service)
+//	keepass:/path/db.kdbx#entry    password of the entry with title or path group/.../title, the database is
+//	                               unlocked with ONA_KEEPASS_PASSWORD and/or ONA_KEEPASS_KEYFILE
+//
+// The resolved references are returned by configuration key, the secrets themselves are never part of an error.
+func ResolveSecrets(configObj *configuration.Config) (map[string]string, error) {
+	resolver := &secretResolver{databases: map[string]*gokeepasslib.Database{}}
+	references := map[string]string{}
+	for _, field := range configFields(configObj, true) {
+		if !field.secret || field.value.Kind() != reflect.String || !IsSecretReference(field.value.String()) {
+			continue
+		}
+		reference := field.value.String()
+		secret, err := resolver.resolve(reference)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot resolve %s of %s", reference, field.key)
+		}
+		field.value.SetString(secret)
+		references[field.key] = reference
+	}
+	return references, nil
+}
+
+type secretResolver struct {
+	databases map[string]*gokeepasslib.Database
+}
+
+func (r *secretResolver) resolve(reference string) (string, error) {
+	switch {
+	case strings.HasPrefix(reference, secretFile):
+		data, err := os.ReadFile(filepath.Clean(strings.TrimPrefix(reference, secretFile)))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(reference, secretEnv):
+		name := strings.TrimPrefix(reference, secretEnv)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(reference, secretKeyring):
+		service, user, ok := strings.Cut(strings.TrimPrefix(reference, secretKeyring), "/")
+		if !ok {
+			return "", errors.New("expected keyring:service/user")
+		}
+		return keyring.Get(service, user)
+	case strings.HasPrefix(reference, secretKeePass):
+		path, entry, ok := strings.Cut(strings.TrimPrefix(reference, secretKeePass), "#")
+		if !ok || entry == "" {
+			return "", errors.New("expected keepass:/path/db.kdbx#entry")
+		}
+		return r.keePass(path, entry)
+	}
+	return "", errors.New("unknown secret reference")
+}
+
+func (r *secretResolver) keePass(path string, entryPath string) (string, error) {
+	path = filepath.Clean(path)
+	db, ok := r.databases[path]
+	if !ok {
+		var err error
+		if db, err = openKeePass(path); err != nil {
+			return "", err
+		}
+		r.databases[path] = db
+	}
+	for _, group := range db.Content.Root.Groups {
+		if secret, ok := findKeePassEntry(group, "", entryPath); ok {
+			return secret, nil
+		}
+	}
+	return "", errors.Errorf("entry '%s' not found in %s", entryPath, path)
+}
+
+func openKeePass(path string) (*gokeepasslib.Database, error) {
+	password, hasPassword := os.LookupEnv(KeePassPasswordEnv)
+	keyFile := os.Getenv(KeePassKeyFileEnv)
+	db := gokeepasslib.NewDatabase()
+	var err error
+	switch {
+	case hasPassword && keyFile != "":
+		db.Credentials, err = gokeepasslib.NewPasswordAndKeyCredentials(password, keyFile)
+	case keyFile != "":
+		db.Credentials, err = gokeepasslib.NewKeyCredentials(keyFile)
+	case hasPassword:
+		db.Credentials = gokeepasslib.NewPasswordCredentials(password)
+	default:
+		return nil, errors.Errorf("set %s or %s to open %s", KeePassPasswordEnv, KeePassKeyFileEnv, path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read key file %s", keyFile)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := gokeepasslib.NewDecoder(file).Decode(db); err != nil {
+		return nil, errors.Wrapf(err, "cannot open %s", path)
+	}
+	if err := db.UnlockProtectedEntries(); err != nil {
+		return nil, errors.Wrapf(err, "cannot unlock %s", path)
+	}
+	return db, nil
+}
+
+// findKeePassEntry searches for an entry with the title entryPath or the path group/.../title. The root group
+// is not part of the path.
+func findKeePassEntry(group gokeepasslib.Group, groupPath string, entryPath string) (string, bool) {
+	for _, entry := range group.Entries {
+		title := entry.GetTitle()
+		if title == entryPath || groupPath+title == entryPath {
+			return entry.GetPassword(), true
+		}
+	}
+	for _, subGroup := range group.Groups {
+		if secret, ok := findKeePassEntry(subGroup, groupPath+subGroup.Name+"/", entryPath); ok {
+			return secret, true
+		}
+	}
+	return "", false
+}
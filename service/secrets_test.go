@@ -0,0 +1,88 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	secretFilePath := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(secretFilePath, []byte("jwt-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ONA_TEST_STORAGE_SECRET", "storage-secret")
+
+	configObj := &configuration.Config{
+		Url:     "file:not-a-secret-field",
+		JwtKey:  "file:" + secretFilePath,
+		Key:     "plain-key",
+		Storage: configuration.Storage{Secret: "env:ONA_TEST_STORAGE_SECRET"},
+	}
+	references, err := ResolveSecrets(configObj)
+	if err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	tests := []struct {
+		key       string
+		value     string
+		reference string
+	}{
+		{"jwt-key", "jwt-secret", "file:" + secretFilePath},
+		{"storage.secret", "storage-secret", "env:ONA_TEST_STORAGE_SECRET"},
+		{"key", "plain-key", ""},
+		{"url", "file:not-a-secret-field", ""},
+	}
+	values := map[string]string{
+		"jwt-key":        configObj.JwtKey,
+		"storage.secret": configObj.Storage.Secret,
+		"key":            configObj.Key,
+		"url":            configObj.Url,
+	}
+	for _, test := range tests {
+		if values[test.key] != test.value {
+			t.Errorf("%s = %q, expected %q", test.key, values[test.key], test.value)
+		}
+		if references[test.key] != test.reference {
+			t.Errorf("reference of %s = %q, expected %q", test.key, references[test.key], test.reference)
+		}
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"missing env", "env:ONA_TEST_SECRET_NOT_SET"},
+		{"missing file", "file:" + filepath.Join(t.TempDir(), "missing")},
+		{"invalid keyring", "keyring:no-user"},
+		{"invalid keepass", "keepass:/no/entry.kdbx"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configObj := &configuration.Config{Storage: configuration.Storage{Secret: test.secret}}
+			if _, err := ResolveSecrets(configObj); err == nil {
+				t.Fatalf("ResolveSecrets of %s succeeded, expected an error", test.secret)
+			}
+		})
+	}
+}
+
+func TestIsSecretReference(t *testing.T) {
+	tests := map[string]bool{
+		"file:/run/secrets/jwt":      true,
+		"env:SECRET":                 true,
+		"keyring:ona/user":           true,
+		"keepass:/path/db.kdbx#jwt":  true,
+		"plain":                      false,
+		"https://example.com/secret": false,
+	}
+	for value, expected := range tests {
+		if IsSecretReference(value) != expected {
+			t.Errorf("IsSecretReference(%q) = %v, expected %v", value, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+// NewTLSConfig creates the TLS configuration for connections to the manager and the TUS server.
+// Without CA files the system trust store is used. Certificate verification is only disabled
+// if Insecure is set explicitly. A pin matches the public key of a certificate sent by the server or of a
+// certificate of its verified chains, e.g. of the CA.
+// certloader, which is used for the logstash connection, is not used here: it expects its own loader
+// configuration and keeps a background reloader which has to be closed, while the manager connection is
+// configured with plain files and needs the system trust store next to the CA files and key pinning.
+func NewTLSConfig(cfg configuration.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.Insecure,
+	}
+	if len(cfg.CA) > 0 {
+		certPool := x509.NewCertPool()
+		for _, caFile := range cfg.CA {
+			caPEM, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot read CA file '%s'", caFile)
+			}
+			if !certPool.AppendCertsFromPEM(caPEM) {
+				return nil, errors.Errorf("no certificates found in CA file '%s'", caFile)
+			}
+		}
+		tlsConfig.RootCAs = certPool
+	}
+	if cfg.Cert != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load client certificate '%s'", cfg.Cert)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(cfg.Pins) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range cfg.Pins {
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			certs := append([]*x509.Certificate{}, state.PeerCertificates...)
+			for _, chain := range state.VerifiedChains {
+				certs = append(certs, chain...)
+			}
+			for _, cert := range certs {
+				digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[base64.StdEncoding.EncodeToString(digest[:])] {
+					return nil
+				}
+			}
+			return errors.Wrapf(ErrPinMismatch, "connection to %s", state.ServerName)
+		}
+	}
+	return tlsConfig, nil
+}
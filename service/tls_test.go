@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+// testCertificate is a key with a certificate issued by parent, self-signed if parent is nil
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, name string, parent *testCertificate, usage x509.ExtKeyUsage) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+// pin returns the base64 encoded sha256 digest of the public key
+func (c *testCertificate) pin() string {
+	digest := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// writeFiles writes certificate and key as PEM files to dir
+func (c *testCertificate) writeFiles(t *testing.T, dir string, name string) (certFile string, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "test ca", nil, x509.ExtKeyUsageAny)
+	serverCert := newTestCertificate(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCertificate(t, "operator", ca, x509.ExtKeyUsageClientAuth)
+	otherCA := newTestCertificate(t, "other ca", nil, x509.ExtKeyUsageAny)
+	otherClient := newTestCertificate(t, "intruder", otherCA, x509.ExtKeyUsageClientAuth)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	otherCAFile, _ := otherCA.writeFiles(t, dir, "other-ca")
+	clientCertFile, clientKeyFile := clientCert.writeFiles(t, dir, "client")
+	otherCertFile, otherKeyFile := otherClient.writeFiles(t, dir, "other-client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	tests := []struct {
+		name          string
+		config        configuration.TLS
+		requireClient bool
+		wantErr       error
+		wantTLSError  bool
+	}{
+		{name: "trusted ca", config: configuration.TLS{CA: []string{caFile}}},
+		{name: "system trust store", wantTLSError: true},
+		{name: "other ca", config: configuration.TLS{CA: []string{otherCAFile}}, wantTLSError: true},
+		{name: "insecure", config: configuration.TLS{Insecure: true}},
+		{name: "pinned server key", config: configuration.TLS{CA: []string{caFile}, Pins: []string{serverCert.pin()}}},
+		{name: "pinned ca key", config: configuration.TLS{CA: []string{caFile}, Pins: []string{otherCA.pin(), ca.pin()}}},
+		{name: "pin mismatch", config: configuration.TLS{CA: []string{caFile}, Pins: []string{otherCA.pin()}}, wantErr: ErrPinMismatch, wantTLSError: true},
+		{name: "pin mismatch insecure", config: configuration.TLS{Insecure: true, Pins: []string{otherCA.pin()}}, wantErr: ErrPinMismatch, wantTLSError: true},
+		{name: "client certificate", config: configuration.TLS{CA: []string{caFile}, Cert: clientCertFile, Key: clientKeyFile}, requireClient: true},
+		{name: "missing client certificate", config: configuration.TLS{CA: []string{caFile}}, requireClient: true, wantTLSError: true},
+		{name: "untrusted client certificate", config: configuration.TLS{CA: []string{caFile}, Cert: otherCertFile, Key: otherKeyFile}, requireClient: true, wantTLSError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{}`))
+			}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate()}}
+			if test.requireClient {
+				server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+				server.TLS.ClientCAs = clientCAs
+			}
+			server.StartTLS()
+			defer server.Close()
+			client, err := NewClient(configuration.Config{StatusUrl: server.URL, JwtKey: "test", Retries: 2, RetryWait: 1, TLS: test.config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.GetStatus(context.Background(), "1")
+			if !test.wantTLSError {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("expected %v, got %v", test.wantErr, err)
+			}
+			// certificate errors are reported at once and not as unavailable manager
+			var apiError *APIError
+			if errors.As(err, &apiError) && (apiError.Retryable() || errors.Is(err, ErrUnavailable)) {
+				t.Errorf("%v should not be retryable", err)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert := newTestCertificate(t, "operator", nil, x509.ExtKeyUsageClientAuth)
+	certFile, _ := cert.writeFiles(t, dir, "client")
+	noCertificates := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(noCertificates, []byte("no certificates"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		config configuration.TLS
+	}{
+		{name: "missing ca file", config: configuration.TLS{CA: []string{filepath.Join(dir, "missing.pem")}}},
+		{name: "ca file without certificates", config: configuration.TLS{CA: []string{noCertificates}}},
+		{name: "certificate without key", config: configuration.TLS{Cert: certFile}},
+		{name: "key is not a key", config: configuration.TLS{Cert: certFile, Key: noCertificates}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewTLSConfig(test.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
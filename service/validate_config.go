@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/filesystem/v3/pkg/vfsrw"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/ocfl-archive/ona/configuration"
+)
+
+// pingStatusId is requested to check the manager, any answer but 401/403 shows it is reachable
+const pingStatusId = "00000000-0000-0000-0000-000000000000"
+
+// ConfigCheck is the result of a single validation step, Err is nil if the check succeeded
+type ConfigCheck struct {
+	Name string
+	Err  error
+}
+
+// CheckConfig checks required fields and the syntax of the configuration without connecting anywhere
+func CheckConfig(configObj *configuration.Config) []ConfigCheck {
+	checks := []ConfigCheck{
+		{Name: "url", Err: checkURL(configObj.Url)},
+		{Name: "status-url", Err: checkURL(configObj.StatusUrl)},
+	}
+	if strings.HasSuffix(configObj.StatusUrl, "/") {
+		checks[1].Err = errors.Errorf("'%s' should not end with /", configObj.StatusUrl)
+	}
+	var chunkErr error
+	if configObj.ChunkSize <= 0 {
+		chunkErr = errors.New("chunk-size must be greater than 0")
+	}
+	checks = append(checks, ConfigCheck{Name: "chunk-size", Err: chunkErr})
+	var authErr error
+	switch {
+	case configObj.OIDC.Issuer != "":
+		if configObj.OIDC.ClientId == "" {
+			authErr = errors.New("oidc.client-id is required with oidc.issuer")
+		} else if err := checkURL(configObj.OIDC.Issuer); err != nil {
+			authErr = errors.Wrap(err, "invalid oidc.issuer")
+		}
+	case configObj.Auth.PrivateKey == "" && configObj.JwtKey == "":
+		authErr = errors.New("jwt-key, auth.private-key or oidc.issuer is required")
+	}
+	checks = append(checks, ConfigCheck{Name: "authentication", Err: authErr})
+	if _, err := NewTLSConfig(configObj.TLS); err != nil {
+		checks = append(checks, ConfigCheck{Name: "tls", Err: err})
+	}
+	for _, storage := range append([]configuration.Storage{configObj.Storage}, configObj.Targets...) {
+		checks = append(checks, ConfigCheck{Name: "storage " + storage.Name, Err: checkStorage(storage)})
+	}
+	return checks
+}
+
+// ValidateConfig runs CheckConfig and connects to the manager, the TUS server and every storage location
+func ValidateConfig(ctx context.Context, configObj *configuration.Config, logger zLogger.ZLogger) []ConfigCheck {
+	checks := CheckConfig(configObj)
+	client, err := NewClient(*configObj)
+	if err != nil {
+		return append(checks, ConfigCheck{Name: "client", Err: err})
+	}
+	checks = append(checks,
+		ConfigCheck{Name: "credentials", Err: client.CheckCredentials(ctx)},
+		ConfigCheck{Name: "manager " + configObj.StatusUrl, Err: client.Ping(ctx)},
+		ConfigCheck{Name: "tus " + configObj.Url, Err: client.PingUpload(ctx)},
+	)
+	vfsConfig, err := LoadVfsConfig(*configObj)
+	if err != nil {
+		return append(checks, ConfigCheck{Name: "storage locations", Err: err})
+	}
+	vfs, err := vfsrw.NewFS(vfsConfig, logger)
+	if err != nil {
+		return append(checks, ConfigCheck{Name: "storage locations", Err: errors.Wrap(err, "cannot create vfs")})
+	}
+	defer vfs.Close()
+	for name := range vfsConfig {
+		_, err := fs.ReadDir(vfs, "vfs://"+name+"/")
+		checks = append(checks, ConfigCheck{Name: "connect storage " + name, Err: errors.Wrapf(err, "cannot list 'vfs://%s/'", name)})
+	}
+	return checks
+}
+
+// CheckCredentials creates a token for the manager, with OIDC this requires a previous ona login
+func (c *Client) CheckCredentials(ctx context.Context) error {
+	_, err := c.tokens.Bearer(ctx)
+	return err
+}
+
+// Ping checks that the manager is reachable and accepts the credentials
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, status+pingStatusId, nil)
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.StatusCode != 0 && !errors.Is(err, ErrUnauthorized) {
+		return nil
+	}
+	return err
+}
+
+// PingUpload checks that the TUS server is reachable and accepts the credentials
+func (c *Client) PingUpload(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, c.config.Url, nil)
+	if err != nil {
+		return err
+	}
+	client := c.UploadHTTPClient(ctx)
+	client.Timeout = c.httpClient.Timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return &APIError{Method: req.Method, URL: req.URL.String(), Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newAPIError(req.Method, req.URL.String(), resp, nil)
+	}
+	if resp.Header.Get("Tus-Version") == "" {
+		return errors.Errorf("%s is not a TUS endpoint, Tus-Version header is missing", c.config.Url)
+	}
+	return nil
+}
+
+func checkURL(raw string) error {
+	if raw == "" {
+		return errors.New("value is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("'%s' should start with http:// or https://", raw)
+	}
+	if u.Host == "" {
+		return errors.Errorf("'%s' has no host", raw)
+	}
+	return nil
+}
+
+func checkStorage(storage configuration.Storage) error {
+	if storage.Name == "" {
+		return errors.New("name is required")
+	}
+	switch storage.Type {
+	case "sftp":
+		if storage.Url == "" {
+			return errors.New("url (host:port) is required")
+		}
+		if storage.User == "" {
+			return errors.New("user is required")
+		}
+		if storage.Secret == "" && len(storage.PrivateKey) == 0 {
+			return errors.New("secret or private-key is required")
+		}
+	default:
+		if storage.Url == "" || storage.Key == "" || storage.Secret == "" {
+			return errors.New("url, key and secret are required for S3")
+		}
+	}
+	return nil
+}